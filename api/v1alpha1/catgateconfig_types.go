@@ -0,0 +1,235 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// CatGateConfigName is the name of the only CatGateConfig that cat-gate reads.
+const CatGateConfigName = "default"
+
+// CatGateConfigSpec defines the throttling parameters of cat-gate.
+type CatGateConfigSpec struct {
+	// ScaleRate is the number of scheduling gates opened per node that already has the images.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:default=2
+	// +optional
+	ScaleRate int32 `json:"scaleRate,omitempty"`
+
+	// MinimumCapacity is the number of scheduling gates opened when no node has the images.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:default=1
+	// +optional
+	MinimumCapacity int32 `json:"minimumCapacity,omitempty"`
+
+	// RequeueSeconds is the interval to re-evaluate a pod whose scheduling gate was not removed.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:default=10
+	// +optional
+	RequeueSeconds int32 `json:"requeueSeconds,omitempty"`
+
+	// GateRemovalDelayMilliSeconds is the minimum interval between removals of
+	// scheduling gates from pods with the same images.
+	// It prevents removing gates based on a stale cache.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:default=10
+	// +optional
+	GateRemovalDelayMilliSeconds int32 `json:"gateRemovalDelayMilliSeconds,omitempty"`
+
+	// MaxGateHoldSeconds is the maximum time to hold the scheduling gate of a pod.
+	// The scheduling gate is removed regardless of the capacity after this time
+	// from the admission of the pod, so that a pod is not gated indefinitely.
+	// No limit is applied if it is not specified.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	MaxGateHoldSeconds int32 `json:"maxGateHoldSeconds,omitempty"`
+
+	// TargetWaitSeconds is the target time for a pod to wait for the removal of its scheduling gate.
+	// While the oldest gated pod with the same images waits longer than this, the capacity
+	// for the images is raised by scaleRate every requeueSeconds.
+	// No target is applied if it is not specified.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	TargetWaitSeconds int32 `json:"targetWaitSeconds,omitempty"`
+
+	// CriticalPriority is the priority from which the scheduling gates of the pods are removed immediately.
+	// The pods with system-cluster-critical or system-node-critical are always regarded as critical.
+	// The critical pods are still counted as pulling images, so that the other pods are throttled accordingly.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:default=2000000000
+	// +optional
+	CriticalPriority int32 `json:"criticalPriority,omitempty"`
+
+	// PullFailureThreshold is the number of image pull failures of the pods with the same images
+	// that stops the removal of the scheduling gates of those pods.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:default=3
+	// +optional
+	PullFailureThreshold int32 `json:"pullFailureThreshold,omitempty"`
+
+	// PullFailureProbeSeconds is the interval to release a pod to probe whether
+	// the images that failed to be pulled can be pulled again.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:default=60
+	// +optional
+	PullFailureProbeSeconds int32 `json:"pullFailureProbeSeconds,omitempty"`
+
+	// RegistryBackoffSeconds is the initial length of the window in which no scheduling gate is removed
+	// for the images of a registry that limits the rate of pulls.
+	// The window doubles while the registry keeps limiting the rate.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:default=30
+	// +optional
+	RegistryBackoffSeconds int32 `json:"registryBackoffSeconds,omitempty"`
+
+	// RegistryBackoffMaxSeconds is the maximum length of the backoff window of a registry.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:default=600
+	// +optional
+	RegistryBackoffMaxSeconds int32 `json:"registryBackoffMaxSeconds,omitempty"`
+
+	// MaxInFlightPulls is the maximum number of pods pulling images across the cluster, regardless of the images.
+	// No limit is applied if it is not specified.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	MaxInFlightPulls int32 `json:"maxInFlightPulls,omitempty"`
+
+	// MaxPullsPerNode is the maximum number of pods pulling images on each node.
+	// No scheduling gate is removed while all nodes that can run the pod reach the limit.
+	// No limit is applied if it is not specified.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	MaxPullsPerNode int32 `json:"maxPullsPerNode,omitempty"`
+
+	// MaxBytesInFlight is the maximum total size of the images being pulled across the cluster.
+	// The sizes of the images are learned from the nodes that already have them.
+	// No limit is applied if it is not specified.
+	// +optional
+	MaxBytesInFlight *resource.Quantity `json:"maxBytesInFlight,omitempty"`
+
+	// TenantLabel is the label of the pods that identifies their tenants.
+	// The capacity across the cluster, i.e. maxInFlightPulls, and the capacity of each registry in registryLimits
+	// are shared among the tenants in proportion to their weights.
+	// The namespace of a pod is its tenant if it is not specified or the pod does not have the label.
+	// +optional
+	TenantLabel string `json:"tenantLabel,omitempty"`
+
+	// TenantWeights are the weights of the tenants for sharing the capacity across the cluster and of the registries.
+	// The weight of a tenant not listed here is taken from the `cat-gate.cybozu.io/weight` annotation
+	// of the namespace of the pod. It is 1 by default.
+	// +listType=map
+	// +listMapKey=name
+	// +optional
+	TenantWeights []TenantWeight `json:"tenantWeights,omitempty"`
+
+	// RegistryLimits limit the removal of scheduling gates for each registry host, regardless of the images hash.
+	// Each removal takes a token from the bucket of every registry host of the images that the pod pulls.
+	// +listType=map
+	// +listMapKey=host
+	// +optional
+	RegistryLimits []RegistryLimit `json:"registryLimits,omitempty"`
+
+	// RemoveAfterGates are the scheduling gates of the other controllers that must be removed
+	// before the scheduling gate of cat-gate is removed.
+	// The pods with any of these gates are neither released nor counted as waiting for the capacity.
+	// +listType=set
+	// +optional
+	RemoveAfterGates []string `json:"removeAfterGates,omitempty"`
+
+	// ImageSightingTTLSeconds is the time for which a node is regarded as having an image
+	// after a running pod with the image or a Pulled event of the image is seen on the node.
+	// The kubelet reports a limited number of images in the node status, so the images are also inferred from them.
+	// The images are inferred only from the node status if it is not specified.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	ImageSightingTTLSeconds int32 `json:"imageSightingTTLSeconds,omitempty"`
+
+	// ExcludedNodeSelector selects the nodes that are excluded from the capacity calculation.
+	// Cordoned nodes, nodes that are not ready and virtual-kubelet nodes are always excluded.
+	// +optional
+	ExcludedNodeSelector *metav1.LabelSelector `json:"excludedNodeSelector,omitempty"`
+}
+
+// TenantWeight is the weight of a tenant.
+type TenantWeight struct {
+	// Name is the name of the tenant, i.e. the value of the tenant label or the name of the namespace.
+	// +kubebuilder:validation:MinLength=1
+	Name string `json:"name"`
+
+	// Weight is the relative share of the capacity across the cluster for the tenant.
+	// +kubebuilder:validation:Minimum=1
+	Weight int32 `json:"weight"`
+}
+
+// RegistryLimit limits the pulls from a registry host with the number of pulls in flight and a token bucket.
+type RegistryLimit struct {
+	// Host is the registry host such as `docker.io` and `quay.io`.
+	// +kubebuilder:validation:MinLength=1
+	Host string `json:"host"`
+
+	// MaxConcurrentPulls is the maximum number of pods pulling images from the registry at once.
+	// It is also the size of the token bucket, i.e. the maximum number of scheduling gates removed at once.
+	// +kubebuilder:validation:Minimum=1
+	MaxConcurrentPulls int32 `json:"maxConcurrentPulls"`
+
+	// RefillPerMinute is the number of tokens added to the bucket per minute.
+	// +kubebuilder:validation:Minimum=1
+	RefillPerMinute int32 `json:"refillPerMinute"`
+}
+
+// CatGateConfigStatus defines the observed state of CatGateConfig
+type CatGateConfigStatus struct {
+	// ObservedGeneration is the generation of the spec that is in effect.
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// Parameters are the throttling parameters currently in effect.
+	// +optional
+	Parameters CatGateConfigSpec `json:"parameters,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:resource:scope=Cluster
+//+kubebuilder:printcolumn:name="SCALE RATE",type="integer",JSONPath=".status.parameters.scaleRate"
+//+kubebuilder:printcolumn:name="MINIMUM CAPACITY",type="integer",JSONPath=".status.parameters.minimumCapacity"
+//+kubebuilder:printcolumn:name="AGE",type="date",JSONPath=".metadata.creationTimestamp"
+//+kubebuilder:validation:XValidation:rule="self.metadata.name == 'default'",message="the name of CatGateConfig must be 'default'"
+
+// CatGateConfig is the cluster-wide configuration of cat-gate.
+type CatGateConfig struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   CatGateConfigSpec   `json:"spec,omitempty"`
+	Status CatGateConfigStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// CatGateConfigList contains a list of CatGateConfig
+type CatGateConfigList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []CatGateConfig `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&CatGateConfig{}, &CatGateConfigList{})
+}
@@ -0,0 +1,82 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// CatGateProfileSpec defines the throttling parameters for the selected pods.
+// The parameters that are not specified are taken from CatGateConfig.
+type CatGateProfileSpec struct {
+	// Selector selects the pods in the namespace to which this profile applies.
+	// If it is omitted, this profile applies to all pods in the namespace.
+	// +optional
+	Selector *metav1.LabelSelector `json:"selector,omitempty"`
+
+	// ScaleRate is the number of scheduling gates opened per node that already has the images.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	ScaleRate *int32 `json:"scaleRate,omitempty"`
+
+	// MinimumCapacity is the number of scheduling gates opened when no node has the images.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	MinimumCapacity *int32 `json:"minimumCapacity,omitempty"`
+
+	// RequeueSeconds is the interval to re-evaluate a pod whose scheduling gate was not removed.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	RequeueSeconds *int32 `json:"requeueSeconds,omitempty"`
+
+	// MaxGateHoldSeconds is the maximum time to hold the scheduling gate of a pod.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	MaxGateHoldSeconds *int32 `json:"maxGateHoldSeconds,omitempty"`
+
+	// TargetWaitSeconds is the target time for a pod to wait for the removal of its scheduling gate.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	TargetWaitSeconds *int32 `json:"targetWaitSeconds,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:printcolumn:name="SCALE RATE",type="integer",JSONPath=".spec.scaleRate"
+//+kubebuilder:printcolumn:name="MINIMUM CAPACITY",type="integer",JSONPath=".spec.minimumCapacity"
+//+kubebuilder:printcolumn:name="AGE",type="date",JSONPath=".metadata.creationTimestamp"
+
+// CatGateProfile is the throttling parameters for the pods selected in a namespace.
+// If several profiles select a pod, the first one in the order of name is used.
+type CatGateProfile struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec CatGateProfileSpec `json:"spec,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// CatGateProfileList contains a list of CatGateProfile
+type CatGateProfileList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []CatGateProfile `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&CatGateProfile{}, &CatGateProfileList{})
+}
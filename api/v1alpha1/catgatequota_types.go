@@ -0,0 +1,64 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// CatGateQuotaSpec defines the limits on the pulls of the pods in a namespace.
+type CatGateQuotaSpec struct {
+	// MaxInFlightPulls is the maximum number of pods pulling images in the namespace.
+	// +kubebuilder:validation:Minimum=1
+	MaxInFlightPulls int32 `json:"maxInFlightPulls"`
+}
+
+// CatGateQuotaStatus defines the observed usage of the namespace.
+type CatGateQuotaStatus struct {
+	// InFlightPulls is the number of pods pulling images in the namespace.
+	// +optional
+	InFlightPulls int32 `json:"inFlightPulls,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name="MAX IN-FLIGHT PULLS",type="integer",JSONPath=".spec.maxInFlightPulls"
+//+kubebuilder:printcolumn:name="IN-FLIGHT PULLS",type="integer",JSONPath=".status.inFlightPulls"
+//+kubebuilder:printcolumn:name="AGE",type="date",JSONPath=".metadata.creationTimestamp"
+
+// CatGateQuota limits the pulls of the pods in a namespace.
+// If several quotas exist in a namespace, all of them are applied.
+type CatGateQuota struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   CatGateQuotaSpec   `json:"spec,omitempty"`
+	Status CatGateQuotaStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// CatGateQuotaList contains a list of CatGateQuota
+type CatGateQuotaList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []CatGateQuota `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&CatGateQuota{}, &CatGateQuotaList{})
+}
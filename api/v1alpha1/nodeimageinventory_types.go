@@ -0,0 +1,73 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// NodeImageInventorySpec is the images on a node.
+type NodeImageInventorySpec struct {
+	// Images are all the images on the node reported by the container runtime.
+	// +optional
+	Images []NodeImage `json:"images,omitempty"`
+
+	// ObservedTime is the time when the images were listed.
+	// +optional
+	ObservedTime metav1.Time `json:"observedTime,omitempty"`
+
+	// IntervalSeconds is the interval at which the images are listed.
+	// The inventory is ignored if it has not been observed for several intervals.
+	// +optional
+	IntervalSeconds int32 `json:"intervalSeconds,omitempty"`
+}
+
+// NodeImage is an image on a node.
+type NodeImage struct {
+	// Names are the tags and the digests of the image, e.g. `docker.io/library/nginx:1.25`.
+	Names []string `json:"names"`
+
+	// SizeBytes is the size of the image in bytes.
+	// +optional
+	SizeBytes int64 `json:"sizeBytes,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:resource:scope=Cluster
+//+kubebuilder:printcolumn:name="AGE",type="date",JSONPath=".metadata.creationTimestamp"
+
+// NodeImageInventory is the complete list of the images on the node of the same name.
+// The node status lists a limited number of images, so the node image agent publishes all of them.
+type NodeImageInventory struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec NodeImageInventorySpec `json:"spec,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// NodeImageInventoryList contains a list of NodeImageInventory
+type NodeImageInventoryList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []NodeImageInventory `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&NodeImageInventory{}, &NodeImageInventoryList{})
+}
@@ -19,21 +19,28 @@ package main
 import (
 	"flag"
 	"os"
+	"time"
 
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
 	// to ensure that exec-entrypoint and run can make use of them.
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/fields"
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
 	"sigs.k8s.io/controller-runtime/pkg/webhook"
 
+	catgatev1alpha1 "github.com/cybozu-go/cat-gate/api/v1alpha1"
 	"github.com/cybozu-go/cat-gate/hooks"
+	"github.com/cybozu-go/cat-gate/internal/agent"
 	"github.com/cybozu-go/cat-gate/internal/controller"
 	"github.com/cybozu-go/cat-gate/internal/indexing"
 	"github.com/cybozu-go/cat-gate/internal/runners"
@@ -47,6 +54,7 @@ var (
 
 func init() {
 	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
+	utilruntime.Must(catgatev1alpha1.AddToScheme(scheme))
 
 	//+kubebuilder:scaffold:scheme
 }
@@ -55,11 +63,22 @@ func main() {
 	var metricsAddr string
 	var enableLeaderElection bool
 	var probeAddr string
+	var nodeImageAgent bool
+	var criEndpoint string
+	var nodeName string
+	var inventoryInterval time.Duration
 	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8080", "The address the metric endpoint binds to.")
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
 	flag.BoolVar(&enableLeaderElection, "leader-elect", false,
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
+	flag.BoolVar(&nodeImageAgent, "node-image-agent", false,
+		"Run as the agent that publishes the images on the node as NodeImageInventory, instead of the controller manager.")
+	flag.StringVar(&criEndpoint, "cri-endpoint", "unix:///run/containerd/containerd.sock",
+		"The endpoint of the CRI image service. Used by the node image agent.")
+	flag.StringVar(&nodeName, "node-name", os.Getenv("NODE_NAME"), "The name of the node. Used by the node image agent.")
+	flag.DurationVar(&inventoryInterval, "inventory-interval", time.Minute,
+		"The interval at which the node image agent publishes the images.")
 	opts := zap.Options{
 		Development: true,
 	}
@@ -68,6 +87,11 @@ func main() {
 
 	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
 
+	if nodeImageAgent {
+		runNodeImageAgent(metricsAddr, probeAddr, criEndpoint, nodeName, inventoryInterval)
+		return
+	}
+
 	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
 		Scheme: scheme,
 		Metrics: metricsserver.Options{
@@ -76,6 +100,12 @@ func main() {
 		WebhookServer: webhook.NewServer(webhook.Options{
 			Port: 9443,
 		}),
+		Cache: cache.Options{
+			// only the Pulled events are read, so the other events are not cached.
+			ByObject: map[client.Object]cache.ByObject{
+				&corev1.Event{}: {Field: fields.OneTermEqualSelector("reason", "Pulled")},
+			},
+		},
 		HealthProbeBindAddress: probeAddr,
 		LeaderElection:         enableLeaderElection,
 		LeaderElectionID:       "ca35e456.cybozu.io",
@@ -104,10 +134,39 @@ func main() {
 	}
 
 	if err = (&controller.PodReconciler{
+		Client:   mgr.GetClient(),
+		Scheme:   mgr.GetScheme(),
+		Recorder: mgr.GetEventRecorderFor("cat-gate"),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "Pod")
+		os.Exit(1)
+	}
+	if err = (&controller.CatGateConfigReconciler{
 		Client: mgr.GetClient(),
 		Scheme: mgr.GetScheme(),
 	}).SetupWithManager(mgr); err != nil {
-		setupLog.Error(err, "unable to create controller", "controller", "Pod")
+		setupLog.Error(err, "unable to create controller", "controller", "CatGateConfig")
+		os.Exit(1)
+	}
+	if err = (&controller.CatGateQuotaReconciler{
+		Client: mgr.GetClient(),
+		Scheme: mgr.GetScheme(),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "CatGateQuota")
+		os.Exit(1)
+	}
+	if err = (&controller.RunningPodReconciler{
+		Client: mgr.GetClient(),
+		Scheme: mgr.GetScheme(),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "RunningPod")
+		os.Exit(1)
+	}
+	if err = (&controller.PulledEventReconciler{
+		Client: mgr.GetClient(),
+		Scheme: mgr.GetScheme(),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "PulledEvent")
 		os.Exit(1)
 	}
 	if err = hooks.SetupPodWebhookWithManager(mgr); err != nil {
@@ -136,3 +195,64 @@ func main() {
 		os.Exit(1)
 	}
 }
+
+// runNodeImageAgent runs the manager of the node image agent.
+// It runs on every node, so neither the leader election nor the webhook is used.
+func runNodeImageAgent(metricsAddr, probeAddr, criEndpoint, nodeName string, interval time.Duration) {
+	if nodeName == "" {
+		setupLog.Error(nil, "--node-name or NODE_NAME must be specified")
+		os.Exit(1)
+	}
+
+	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
+		Scheme: scheme,
+		Metrics: metricsserver.Options{
+			BindAddress: metricsAddr,
+		},
+		Client: client.Options{
+			Cache: &client.CacheOptions{
+				// the agent reads a single node and its inventory, so nothing is cached.
+				DisableFor: []client.Object{&corev1.Node{}, &catgatev1alpha1.NodeImageInventory{}},
+			},
+		},
+		HealthProbeBindAddress: probeAddr,
+	})
+	if err != nil {
+		setupLog.Error(err, "unable to start manager")
+		os.Exit(1)
+	}
+
+	imageService, conn, err := agent.NewImageServiceClient(criEndpoint)
+	if err != nil {
+		setupLog.Error(err, "unable to connect to the CRI image service", "endpoint", criEndpoint)
+		os.Exit(1)
+	}
+
+	if err = mgr.Add(agent.NodeImageAgent{
+		Client:       mgr.GetClient(),
+		Scheme:       mgr.GetScheme(),
+		ImageService: imageService,
+		NodeName:     nodeName,
+		Interval:     interval,
+	}); err != nil {
+		setupLog.Error(err, "unable to add node image agent")
+		os.Exit(1)
+	}
+
+	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
+		setupLog.Error(err, "unable to set up health check")
+		os.Exit(1)
+	}
+	if err := mgr.AddReadyzCheck("readyz", healthz.Ping); err != nil {
+		setupLog.Error(err, "unable to set up ready check")
+		os.Exit(1)
+	}
+
+	setupLog.Info("starting node image agent", "node", nodeName)
+	err = mgr.Start(ctrl.SetupSignalHandler())
+	conn.Close()
+	if err != nil {
+		setupLog.Error(err, "problem running node image agent")
+		os.Exit(1)
+	}
+}
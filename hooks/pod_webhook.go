@@ -7,11 +7,18 @@ import (
 	"fmt"
 	"sort"
 	"strings"
+	"time"
 
+	catgatev1alpha1 "github.com/cybozu-go/cat-gate/api/v1alpha1"
 	"github.com/cybozu-go/cat-gate/internal/constants"
+	"github.com/cybozu-go/cat-gate/internal/imageref"
 	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
 )
 
@@ -21,40 +28,124 @@ import (
 func SetupPodWebhookWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewWebhookManagedBy(mgr).
 		For(&corev1.Pod{}).
-		WithDefaulter(&PodDefaulter{}).
+		WithDefaulter(&PodDefaulter{client: mgr.GetClient()}).
 		Complete()
 }
 
 //+kubebuilder:webhook:path=/mutate--v1-pod,mutating=true,failurePolicy=fail,sideEffects=None,groups=core,resources=pods,verbs=create,versions=v1,name=pod.cat-gate.cybozu.io,admissionReviewVersions=v1
 
-type PodDefaulter struct{}
+//+kubebuilder:rbac:groups=cat-gate.cybozu.io,resources=catgateprofiles,verbs=get;list;watch
+
+type PodDefaulter struct {
+	client client.Reader
+}
 
 var _ admission.CustomDefaulter = &PodDefaulter{}
 
 // Default implements webhook.Defaulter so a webhook will be registered for the type
-func (*PodDefaulter) Default(ctx context.Context, obj runtime.Object) error {
+func (d *PodDefaulter) Default(ctx context.Context, obj runtime.Object) error {
 	pod, ok := obj.(*corev1.Pod)
 	if !ok {
 		return fmt.Errorf("unknown newObj type %T", obj)
 	}
 
+	// the pods pulling no images do not need to be throttled.
+	if !pullsImages(pod) {
+		return nil
+	}
+
 	pod.Spec.SchedulingGates = append(pod.Spec.SchedulingGates, corev1.PodSchedulingGate{Name: constants.PodSchedulingGateName})
 	if pod.Annotations == nil {
 		pod.Annotations = make(map[string]string)
 	}
 
 	pod.Annotations[constants.CatGateImagesHashAnnotation] = generateImagesHash(pod)
+	// the controller measures how long the pod has been gated from this time.
+	pod.Annotations[constants.CatGateGatedAtAnnotation] = time.Now().UTC().Format(time.RFC3339)
+
+	// the lookup of the profile is best-effort, because an error would reject the creation of every pod.
+	// the pod is gated with the default parameters instead.
+	profile, err := d.findProfile(ctx, pod)
+	if err != nil {
+		log.FromContext(ctx).Error(err, "failed to find profile, so the default parameters are used")
+		return nil
+	}
+	if profile != "" {
+		pod.Annotations[constants.CatGateProfileAnnotation] = profile
+	}
 
 	return nil
 }
 
+// findProfile returns the name of the first CatGateProfile in the order of name that selects the pod.
+func (d *PodDefaulter) findProfile(ctx context.Context, pod *corev1.Pod) (string, error) {
+	logger := log.FromContext(ctx)
+
+	namespace := pod.Namespace
+	if namespace == "" {
+		req, err := admission.RequestFromContext(ctx)
+		if err != nil {
+			return "", err
+		}
+		namespace = req.Namespace
+	}
+
+	profiles := &catgatev1alpha1.CatGateProfileList{}
+	err := d.client.List(ctx, profiles, client.InNamespace(namespace))
+	if err != nil {
+		return "", fmt.Errorf("failed to list profiles: %w", err)
+	}
+	sort.Slice(profiles.Items, func(i, j int) bool {
+		return profiles.Items[i].Name < profiles.Items[j].Name
+	})
+
+	for _, profile := range profiles.Items {
+		selector := labels.Everything()
+		if profile.Spec.Selector != nil {
+			selector, err = metav1.LabelSelectorAsSelector(profile.Spec.Selector)
+			if err != nil {
+				// an invalid profile must not block the creation of pods.
+				logger.Error(err, "ignore profile with invalid selector", "profile", profile.Name)
+				continue
+			}
+		}
+		if selector.Matches(labels.Set(pod.Labels)) {
+			return profile.Name, nil
+		}
+	}
+	return "", nil
+}
+
+// pullsImages returns true if any container of the pod may pull its image.
+func pullsImages(pod *corev1.Pod) bool {
+	for _, c := range pod.Spec.InitContainers {
+		if c.ImagePullPolicy != corev1.PullNever {
+			return true
+		}
+	}
+	for _, c := range pod.Spec.Containers {
+		if c.ImagePullPolicy != corev1.PullNever {
+			return true
+		}
+	}
+	return false
+}
+
 func generateImagesHash(pod *corev1.Pod) string {
+	// normalize the images so that the references to the same image have the same hash.
+	// the images of the containers with the Never pull policy are not pulled, so they are excluded.
 	imageSet := make(map[string]struct{})
 	for _, c := range pod.Spec.InitContainers {
-		imageSet[c.Image] = struct{}{}
+		if c.ImagePullPolicy == corev1.PullNever {
+			continue
+		}
+		imageSet[imageref.Normalize(c.Image)] = struct{}{}
 	}
 	for _, c := range pod.Spec.Containers {
-		imageSet[c.Image] = struct{}{}
+		if c.ImagePullPolicy == corev1.PullNever {
+			continue
+		}
+		imageSet[imageref.Normalize(c.Image)] = struct{}{}
 	}
 
 	images := make([]string, 0)
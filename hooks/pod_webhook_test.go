@@ -2,7 +2,10 @@ package hooks
 
 import (
 	"context"
+	"errors"
+	"time"
 
+	catgatev1alpha1 "github.com/cybozu-go/cat-gate/api/v1alpha1"
 	"github.com/cybozu-go/cat-gate/internal/constants"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
@@ -45,5 +48,225 @@ var _ = Describe("Webhook Test", func() {
 		Expect(err).NotTo(HaveOccurred())
 		Expect(pod.Spec.SchedulingGates).To(ConsistOf(corev1.PodSchedulingGate{Name: constants.PodSchedulingGateName}))
 		Expect(pod.Annotations).To(HaveKeyWithValue(constants.CatGateImagesHashAnnotation, "060e64ec0b5abc015254466dc4d0ec89bc4e996121ff5b0f7fc120df3f15954e"))
+		Expect(pod.Annotations).NotTo(HaveKey(constants.CatGateProfileAnnotation))
+		Expect(pod.Annotations).To(HaveKey(constants.CatGateGatedAtAnnotation))
+		_, err = time.Parse(time.RFC3339, pod.Annotations[constants.CatGateGatedAtAnnotation])
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("should not add scheduling gate to pod that pulls no images", func() {
+		sample := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: "default",
+				Name:      "never-pull",
+			},
+			Spec: corev1.PodSpec{
+				InitContainers: []corev1.Container{
+					{
+						Name:            "sample1",
+						Image:           "example.com/sample1-image:1.0.0",
+						ImagePullPolicy: corev1.PullNever,
+					},
+				},
+				Containers: []corev1.Container{
+					{
+						Name:            "sample2",
+						Image:           "example.com/sample2-image:1.0.0",
+						ImagePullPolicy: corev1.PullNever,
+					},
+				},
+			},
+		}
+		err := k8sClient.Create(ctx, sample)
+		Expect(err).NotTo(HaveOccurred())
+
+		pod := &corev1.Pod{}
+		err = k8sClient.Get(ctx, client.ObjectKey{Name: "never-pull", Namespace: "default"}, pod)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(pod.Spec.SchedulingGates).To(BeEmpty())
+		Expect(pod.Annotations).NotTo(HaveKey(constants.CatGateImagesHashAnnotation))
+	})
+
+	It("should generate the same hash for the references to the same image", func() {
+		short := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: "default",
+				Name:      "short-name",
+			},
+			Spec: corev1.PodSpec{
+				Containers: []corev1.Container{
+					{
+						Name:  "ubuntu",
+						Image: "ubuntu:22.04",
+					},
+				},
+			},
+		}
+		err := k8sClient.Create(ctx, short)
+		Expect(err).NotTo(HaveOccurred())
+
+		qualified := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: "default",
+				Name:      "qualified-name",
+			},
+			Spec: corev1.PodSpec{
+				Containers: []corev1.Container{
+					{
+						Name:  "ubuntu",
+						Image: "docker.io/library/ubuntu:22.04",
+					},
+				},
+			},
+		}
+		err = k8sClient.Create(ctx, qualified)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(short.Annotations[constants.CatGateImagesHashAnnotation]).To(Equal(qualified.Annotations[constants.CatGateImagesHashAnnotation]))
+	})
+
+	It("should generate the hash only from the images that are pulled", func() {
+		mixed := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: "default",
+				Name:      "mixed-pull-policies",
+			},
+			Spec: corev1.PodSpec{
+				InitContainers: []corev1.Container{
+					{
+						Name:            "sample1",
+						Image:           "example.com/sample1-image:1.0.0",
+						ImagePullPolicy: corev1.PullNever,
+					},
+				},
+				Containers: []corev1.Container{
+					{
+						Name:            "sample2",
+						Image:           "example.com/sample2-image:1.0.0",
+						ImagePullPolicy: corev1.PullIfNotPresent,
+					},
+				},
+			},
+		}
+		err := k8sClient.Create(ctx, mixed)
+		Expect(err).NotTo(HaveOccurred())
+
+		pulledOnly := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: "default",
+				Name:      "pulled-only",
+			},
+			Spec: corev1.PodSpec{
+				Containers: []corev1.Container{
+					{
+						Name:            "sample2",
+						Image:           "example.com/sample2-image:1.0.0",
+						ImagePullPolicy: corev1.PullIfNotPresent,
+					},
+				},
+			},
+		}
+		err = k8sClient.Create(ctx, pulledOnly)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(mixed.Spec.SchedulingGates).To(ContainElement(corev1.PodSchedulingGate{Name: constants.PodSchedulingGateName}))
+		Expect(mixed.Annotations).To(HaveKey(constants.CatGateImagesHashAnnotation))
+		Expect(mixed.Annotations[constants.CatGateImagesHashAnnotation]).To(Equal(pulledOnly.Annotations[constants.CatGateImagesHashAnnotation]))
+	})
+
+	It("should add the name of the matching profile to pod", func() {
+		namespace := &corev1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "profile",
+			},
+		}
+		err := k8sClient.Create(ctx, namespace)
+		Expect(err).NotTo(HaveOccurred())
+
+		batchProfile := &catgatev1alpha1.CatGateProfile{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: "profile",
+				Name:      "a-batch",
+			},
+			Spec: catgatev1alpha1.CatGateProfileSpec{
+				Selector: &metav1.LabelSelector{
+					MatchLabels: map[string]string{"app": "batch"},
+				},
+			},
+		}
+		err = k8sClient.Create(ctx, batchProfile)
+		Expect(err).NotTo(HaveOccurred())
+
+		defaultProfile := &catgatev1alpha1.CatGateProfile{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: "profile",
+				Name:      "b-default",
+			},
+		}
+		err = k8sClient.Create(ctx, defaultProfile)
+		Expect(err).NotTo(HaveOccurred())
+
+		// the profiles may not be in the cache of the webhook yet, so retry with new pods.
+		Eventually(func(g Gomega) {
+			pod := createProfileTestPod(g, map[string]string{"app": "batch"})
+			g.Expect(pod.Annotations).To(HaveKeyWithValue(constants.CatGateProfileAnnotation, "a-batch"))
+		}).Should(Succeed())
+		Eventually(func(g Gomega) {
+			pod := createProfileTestPod(g, map[string]string{"app": "web"})
+			g.Expect(pod.Annotations).To(HaveKeyWithValue(constants.CatGateProfileAnnotation, "b-default"))
+		}).Should(Succeed())
+	})
+
+	It("should gate pod with the default parameters when profiles cannot be listed", func() {
+		defaulter := &PodDefaulter{client: failingReader{}}
+		pod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: "default",
+				Name:      "profile-error",
+			},
+			Spec: corev1.PodSpec{
+				Containers: []corev1.Container{
+					{
+						Name:  "sample",
+						Image: "example.com/sample-image:1.0.0",
+					},
+				},
+			},
+		}
+		err := defaulter.Default(ctx, pod)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(pod.Spec.SchedulingGates).To(ContainElement(corev1.PodSchedulingGate{Name: constants.PodSchedulingGateName}))
+		Expect(pod.Annotations).To(HaveKey(constants.CatGateImagesHashAnnotation))
+		Expect(pod.Annotations).NotTo(HaveKey(constants.CatGateProfileAnnotation))
 	})
 })
+
+// failingReader is client.Reader that fails to list any object.
+type failingReader struct {
+	client.Reader
+}
+
+func (failingReader) List(context.Context, client.ObjectList, ...client.ListOption) error {
+	return errors.New("unavailable")
+}
+
+func createProfileTestPod(g Gomega, labels map[string]string) *corev1.Pod {
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:    "profile",
+			GenerateName: "sample-",
+			Labels:       labels,
+		},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{
+				{
+					Name:  "sample",
+					Image: "example.com/sample-image:1.0.0",
+				},
+			},
+		},
+	}
+	err := k8sClient.Create(ctx, pod)
+	g.Expect(err).NotTo(HaveOccurred())
+	return pod
+}
@@ -0,0 +1,113 @@
+package agent
+
+import (
+	"context"
+	"io"
+	"sort"
+	"time"
+
+	catgatev1alpha1 "github.com/cybozu-go/cat-gate/api/v1alpha1"
+	"github.com/cybozu-go/cat-gate/internal/constants"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	runtimeapi "k8s.io/cri-api/pkg/apis/runtime/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// NodeImageAgent publishes the images on the node reported by the CRI image service as NodeImageInventory.
+type NodeImageAgent struct {
+	Client       client.Client
+	Scheme       *runtime.Scheme
+	ImageService runtimeapi.ImageServiceClient
+	NodeName     string
+	Interval     time.Duration
+}
+
+// NewImageServiceClient connects to the CRI image service at the endpoint, e.g. unix:///run/containerd/containerd.sock.
+// The returned Closer closes the connection.
+func NewImageServiceClient(endpoint string) (runtimeapi.ImageServiceClient, io.Closer, error) {
+	conn, err := grpc.Dial(endpoint, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return nil, nil, err
+	}
+	return runtimeapi.NewImageServiceClient(conn), conn, nil
+}
+
+// NeedLeaderElection returns false because the agent runs on every node.
+func (a NodeImageAgent) NeedLeaderElection() bool {
+	return false
+}
+
+// Start publishes the images every interval until the context is canceled.
+func (a NodeImageAgent) Start(ctx context.Context) error {
+	ticker := time.NewTicker(a.Interval)
+	defer ticker.Stop()
+	logger := log.FromContext(ctx)
+
+	for {
+		err := a.Publish(ctx)
+		if err != nil {
+			logger.Error(err, "failed to publish the images of the node", "node", a.NodeName)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// Publish creates or updates NodeImageInventory of the node with the images listed by the CRI image service.
+func (a NodeImageAgent) Publish(ctx context.Context) error {
+	logger := log.FromContext(ctx)
+
+	resp, err := a.ImageService.ListImages(ctx, &runtimeapi.ListImagesRequest{})
+	if err != nil {
+		return err
+	}
+	var images []catgatev1alpha1.NodeImage
+	for _, image := range resp.Images {
+		names := append(append([]string{}, image.RepoTags...), image.RepoDigests...)
+		if len(names) == 0 {
+			continue
+		}
+		images = append(images, catgatev1alpha1.NodeImage{
+			Names:     names,
+			SizeBytes: int64(image.Size_),
+		})
+	}
+	// the order of the images is fixed so that the inventory is easy to compare.
+	sort.Slice(images, func(i, j int) bool {
+		return images[i].Names[0] < images[j].Names[0]
+	})
+
+	node := &corev1.Node{}
+	err = a.Client.Get(ctx, client.ObjectKey{Name: a.NodeName}, node)
+	if err != nil {
+		return err
+	}
+
+	inventory := &catgatev1alpha1.NodeImageInventory{}
+	inventory.Name = a.NodeName
+	op, err := controllerutil.CreateOrUpdate(ctx, a.Client, inventory, func() error {
+		inventory.Spec.Images = images
+		// the inventory is updated every interval even if the images do not change, so that it is known to be fresh.
+		inventory.Spec.ObservedTime = metav1.Now()
+		inventory.Spec.IntervalSeconds = int32(max(a.Interval/time.Second, 1))
+		// the inventory is deleted with the node.
+		return controllerutil.SetOwnerReference(node, inventory, a.Scheme)
+	})
+	if err != nil {
+		return err
+	}
+	if op != controllerutil.OperationResultNone {
+		logger.V(constants.LevelDebug).Info("published the images of the node", "node", a.NodeName, "numImages", len(images), "operation", op)
+	}
+	return nil
+}
@@ -0,0 +1,156 @@
+package agent
+
+import (
+	"context"
+	"net"
+	"path/filepath"
+	"sync"
+	"time"
+
+	catgatev1alpha1 "github.com/cybozu-go/cat-gate/api/v1alpha1"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"google.golang.org/grpc"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	runtimeapi "k8s.io/cri-api/pkg/apis/runtime/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// fakeImageService is the CRI image service that lists the given images.
+type fakeImageService struct {
+	runtimeapi.UnimplementedImageServiceServer
+
+	mu     sync.Mutex
+	images []*runtimeapi.Image
+}
+
+func (s *fakeImageService) ListImages(context.Context, *runtimeapi.ListImagesRequest) (*runtimeapi.ListImagesResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return &runtimeapi.ListImagesResponse{Images: s.images}, nil
+}
+
+func (s *fakeImageService) setImages(images []*runtimeapi.Image) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.images = images
+}
+
+// startFakeImageService serves the fake CRI image service on a unix socket and returns its endpoint.
+func startFakeImageService(service *fakeImageService) string {
+	socket := filepath.Join(GinkgoT().TempDir(), "cri.sock")
+	listener, err := net.Listen("unix", socket)
+	Expect(err).NotTo(HaveOccurred())
+
+	server := grpc.NewServer()
+	runtimeapi.RegisterImageServiceServer(server, service)
+	go func() {
+		_ = server.Serve(listener)
+	}()
+	DeferCleanup(server.Stop)
+	return "unix://" + socket
+}
+
+func createNode(name string) *corev1.Node {
+	node := &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: name,
+		},
+	}
+	err := k8sClient.Create(ctx, node)
+	Expect(err).NotTo(HaveOccurred())
+	return node
+}
+
+func newAgent(endpoint, nodeName string) NodeImageAgent {
+	imageService, conn, err := NewImageServiceClient(endpoint)
+	Expect(err).NotTo(HaveOccurred())
+	DeferCleanup(conn.Close)
+	return NodeImageAgent{
+		Client:       k8sClient,
+		Scheme:       scheme,
+		ImageService: imageService,
+		NodeName:     nodeName,
+		Interval:     time.Minute,
+	}
+}
+
+var _ = Describe("NodeImageAgent", func() {
+	It("should publish all the images on the node", func() {
+		service := &fakeImageService{
+			images: []*runtimeapi.Image{
+				{
+					Id:          "sha256:2",
+					RepoTags:    []string{"ghcr.io/cybozu/ubuntu:22.04"},
+					RepoDigests: []string{"ghcr.io/cybozu/ubuntu@sha256:0123456789abcdef"},
+					Size_:       2000,
+				},
+				{
+					Id:       "sha256:1",
+					RepoTags: []string{"docker.io/library/nginx:1.25"},
+					Size_:    1000,
+				},
+				{
+					// the images without names, e.g. dangling images, are not published.
+					Id:    "sha256:3",
+					Size_: 3000,
+				},
+			},
+		}
+		endpoint := startFakeImageService(service)
+		node := createNode("publish")
+		agent := newAgent(endpoint, node.Name)
+
+		err := agent.Publish(ctx)
+		Expect(err).NotTo(HaveOccurred())
+
+		inventory := &catgatev1alpha1.NodeImageInventory{}
+		err = k8sClient.Get(ctx, client.ObjectKey{Name: node.Name}, inventory)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(inventory.Spec.Images).To(Equal([]catgatev1alpha1.NodeImage{
+			{Names: []string{"docker.io/library/nginx:1.25"}, SizeBytes: 1000},
+			{Names: []string{"ghcr.io/cybozu/ubuntu:22.04", "ghcr.io/cybozu/ubuntu@sha256:0123456789abcdef"}, SizeBytes: 2000},
+		}))
+		Expect(inventory.OwnerReferences).To(HaveLen(1))
+		Expect(inventory.OwnerReferences[0].UID).To(Equal(node.UID))
+		Expect(inventory.Spec.ObservedTime.IsZero()).To(BeFalse())
+		Expect(inventory.Spec.IntervalSeconds).To(BeEquivalentTo(60))
+	})
+
+	It("should update the inventory when the images change", func() {
+		service := &fakeImageService{
+			images: []*runtimeapi.Image{
+				{Id: "sha256:1", RepoTags: []string{"docker.io/library/nginx:1.25"}, Size_: 1000},
+			},
+		}
+		endpoint := startFakeImageService(service)
+		node := createNode("update")
+		agent := newAgent(endpoint, node.Name)
+
+		err := agent.Publish(ctx)
+		Expect(err).NotTo(HaveOccurred())
+
+		service.setImages([]*runtimeapi.Image{
+			{Id: "sha256:2", RepoTags: []string{"docker.io/library/nginx:1.27"}, Size_: 1100},
+		})
+		err = agent.Publish(ctx)
+		Expect(err).NotTo(HaveOccurred())
+
+		inventory := &catgatev1alpha1.NodeImageInventory{}
+		err = k8sClient.Get(ctx, client.ObjectKey{Name: node.Name}, inventory)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(inventory.Spec.Images).To(Equal([]catgatev1alpha1.NodeImage{
+			{Names: []string{"docker.io/library/nginx:1.27"}, SizeBytes: 1100},
+		}))
+	})
+
+	It("should fail when the node does not exist", func() {
+		service := &fakeImageService{}
+		endpoint := startFakeImageService(service)
+		agent := newAgent(endpoint, "missing")
+
+		err := agent.Publish(ctx)
+		Expect(err).To(HaveOccurred())
+	})
+})
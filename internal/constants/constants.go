@@ -4,8 +4,13 @@ const MetaPrefix = "cat-gate.cybozu.io/"
 
 const PodSchedulingGateName = MetaPrefix + "gate"
 const CatGateImagesHashAnnotation = MetaPrefix + "images-hash"
+const CatGateProfileAnnotation = MetaPrefix + "profile"
+const CatGateGatedAtAnnotation = MetaPrefix + "gated-at"
+const CatGateAwaitingGatesAnnotation = MetaPrefix + "awaiting-gates"
+const CatGateWeightAnnotation = MetaPrefix + "weight"
 
 const ImageHashAnnotationField = ".metadata.annotations.images-hash"
+const ReleasedPodPhaseField = ".status.phase.released"
 
 const LevelWarning = 1
 const LevelDebug = -1
@@ -0,0 +1,59 @@
+package controller
+
+import (
+	"sync"
+	"time"
+)
+
+// CapacityBoosts records the capacity boost of each images hash.
+var CapacityBoosts = sync.Map{}
+
+// CapacityBoost raises the capacity of an images hash step by step
+// while the oldest gated pod with the images hash waits longer than the target.
+// It is lowered step by step once the waits come back under the target.
+type CapacityBoost struct {
+	mu        sync.Mutex
+	steps     int
+	steppedAt time.Time
+	updatedAt time.Time
+}
+
+// loadCapacityBoost returns the capacity boost for the images hash.
+func loadCapacityBoost(hash string) *CapacityBoost {
+	value, _ := CapacityBoosts.LoadOrStore(hash, &CapacityBoost{})
+	return value.(*CapacityBoost)
+}
+
+// LastUpdated returns the last time the boost was evaluated.
+func (b *CapacityBoost) LastUpdated() time.Time {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.updatedAt
+}
+
+// observe raises the boost by a step if the oldest gated pod waits longer than the target, and lowers it otherwise.
+// The boost changes at most once per interval. It returns the current number of steps.
+func (b *CapacityBoost) observe(now time.Time, oldestWait, target, interval time.Duration) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.updatedAt = now
+
+	elapsed := now.Sub(b.steppedAt)
+	if elapsed < interval {
+		return b.steps
+	}
+	// the boost is not observed while the images hash has no gated pods, e.g. after a rollout finishes.
+	// it is lowered for those intervals so that the next rollout does not start with the boost.
+	if missed := int(elapsed/interval) - 1; missed > 0 {
+		b.steps = max(b.steps-missed, 0)
+	}
+	switch {
+	case oldestWait > target:
+		b.steps += 1
+		b.steppedAt = now
+	case b.steps > 0:
+		b.steps -= 1
+		b.steppedAt = now
+	}
+	return b.steps
+}
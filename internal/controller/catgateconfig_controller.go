@@ -0,0 +1,56 @@
+package controller
+
+import (
+	"context"
+
+	catgatev1alpha1 "github.com/cybozu-go/cat-gate/api/v1alpha1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// CatGateConfigReconciler reports the parameters in effect to the status of CatGateConfig.
+type CatGateConfigReconciler struct {
+	client.Client
+	Scheme *runtime.Scheme
+}
+
+//+kubebuilder:rbac:groups=cat-gate.cybozu.io,resources=catgateconfigs,verbs=get;list;watch
+//+kubebuilder:rbac:groups=cat-gate.cybozu.io,resources=catgateconfigs/status,verbs=get;update;patch
+
+// Reconcile updates the status of CatGateConfig.
+func (r *CatGateConfigReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	cfg := &catgatev1alpha1.CatGateConfig{}
+	err := r.Get(ctx, req.NamespacedName, cfg)
+	if err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+
+	status := catgatev1alpha1.CatGateConfigStatus{
+		ObservedGeneration: cfg.Generation,
+		Parameters:         *effectiveConfig(cfg),
+	}
+	if equality.Semantic.DeepEqual(cfg.Status, status) {
+		return ctrl.Result{}, nil
+	}
+
+	cfg.Status = status
+	err = r.Status().Update(ctx, cfg)
+	if err != nil {
+		logger.Error(err, "failed to update status")
+		return ctrl.Result{}, err
+	}
+	logger.Info("parameters updated", "parameters", status.Parameters)
+	return ctrl.Result{}, nil
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *CatGateConfigReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&catgatev1alpha1.CatGateConfig{}).
+		Complete(r)
+}
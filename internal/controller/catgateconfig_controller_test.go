@@ -0,0 +1,116 @@
+package controller
+
+import (
+	"context"
+
+	catgatev1alpha1 "github.com/cybozu-go/cat-gate/api/v1alpha1"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+var _ = Describe("CatGateConfig controller", func() {
+
+	ctx := context.Background()
+
+	It("should report the parameters in effect", func() {
+		cfg := &catgatev1alpha1.CatGateConfig{}
+		Eventually(func(g Gomega) {
+			err := k8sClient.Get(ctx, client.ObjectKey{Name: catgatev1alpha1.CatGateConfigName}, cfg)
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(cfg.Status.ObservedGeneration).To(Equal(cfg.Generation))
+			g.Expect(cfg.Status.Parameters).To(Equal(catgatev1alpha1.CatGateConfigSpec{
+				ScaleRate:                    defaultScaleRate,
+				MinimumCapacity:              defaultMinimumCapacity,
+				RequeueSeconds:               1,
+				GateRemovalDelayMilliSeconds: defaultGateRemovalDelayMilliSeconds,
+				CriticalPriority:             defaultCriticalPriority,
+				PullFailureThreshold:         defaultPullFailureThreshold,
+				PullFailureProbeSeconds:      defaultPullFailureProbeSeconds,
+				RegistryBackoffSeconds:       defaultRegistryBackoffSeconds,
+				RegistryBackoffMaxSeconds:    defaultRegistryBackoffMaxSeconds,
+			}))
+		}).Should(Succeed())
+	})
+
+	It("should reject CatGateConfig with invalid parameters", func() {
+		cfg := &catgatev1alpha1.CatGateConfig{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "invalid",
+			},
+		}
+		err := k8sClient.Create(ctx, cfg)
+		Expect(err).To(HaveOccurred())
+
+		cfg = &catgatev1alpha1.CatGateConfig{}
+		err = k8sClient.Get(ctx, client.ObjectKey{Name: catgatev1alpha1.CatGateConfigName}, cfg)
+		Expect(err).NotTo(HaveOccurred())
+		cfg.Spec.ScaleRate = -1
+		err = k8sClient.Update(ctx, cfg)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should apply the updated scale rate without restarting", func() {
+		testName := "update-scale-rate"
+		namespace := &corev1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: testName,
+			},
+		}
+		err := k8sClient.Create(ctx, namespace)
+		Expect(err).NotTo(HaveOccurred())
+
+		updateConfig(func(spec *catgatev1alpha1.CatGateConfigSpec) {
+			spec.ScaleRate = 4
+		})
+		DeferCleanup(func() {
+			updateConfig(func(spec *catgatev1alpha1.CatGateConfigSpec) {
+				spec.ScaleRate = defaultScaleRate
+			})
+		})
+
+		for i := 0; i < 10; i++ {
+			createNewPod(testName, i)
+			createNewNode(testName, i)
+		}
+
+		pods := &corev1.PodList{}
+		Eventually(func(g Gomega) {
+			err := k8sClient.List(ctx, pods, &client.ListOptions{Namespace: testName})
+			g.Expect(err).NotTo(HaveOccurred())
+			numSchedulable := 0
+			for _, pod := range pods.Items {
+				if !existsSchedulingGate(&pod) {
+					numSchedulable += 1
+				}
+			}
+			// no nodes with images exist, so 1 pods should be scheduled
+			g.Expect(numSchedulable).To(Equal(1))
+		}).Should(Succeed())
+		scheduleAndStartPods(testName)
+
+		Eventually(func(g Gomega) {
+			err := k8sClient.List(ctx, pods, &client.ListOptions{Namespace: testName})
+			g.Expect(err).NotTo(HaveOccurred())
+			numSchedulable := 0
+			for _, pod := range pods.Items {
+				if !existsSchedulingGate(&pod) {
+					numSchedulable += 1
+				}
+			}
+			// several images exist on 1 node, so 5(1 + 1*4) pods should be scheduled
+			g.Expect(numSchedulable).To(Equal(5))
+		}).Should(Succeed())
+	})
+})
+
+func updateConfig(mutate func(spec *catgatev1alpha1.CatGateConfigSpec)) {
+	cfg := &catgatev1alpha1.CatGateConfig{}
+	err := k8sClient.Get(ctx, client.ObjectKey{Name: catgatev1alpha1.CatGateConfigName}, cfg)
+	Expect(err).NotTo(HaveOccurred())
+	mutate(&cfg.Spec)
+	err = k8sClient.Update(ctx, cfg)
+	Expect(err).NotTo(HaveOccurred())
+}
@@ -0,0 +1,158 @@
+package controller
+
+import (
+	"context"
+	"slices"
+
+	catgatev1alpha1 "github.com/cybozu-go/cat-gate/api/v1alpha1"
+	"github.com/cybozu-go/cat-gate/internal/constants"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// CatGateQuotaReconciler reports the usage of the namespace to the status of CatGateQuota.
+type CatGateQuotaReconciler struct {
+	client.Client
+	Scheme *runtime.Scheme
+}
+
+//+kubebuilder:rbac:groups=cat-gate.cybozu.io,resources=catgatequotas,verbs=get;list;watch
+//+kubebuilder:rbac:groups=cat-gate.cybozu.io,resources=catgatequotas/status,verbs=get;update;patch
+
+// Reconcile updates the status of CatGateQuota.
+func (r *CatGateQuotaReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	quota := &catgatev1alpha1.CatGateQuota{}
+	err := r.Get(ctx, req.NamespacedName, quota)
+	if err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+
+	numPulling, err := countPullingPods(ctx, r, quota.Namespace)
+	if err != nil {
+		logger.Error(err, "failed to list pods")
+		return ctrl.Result{}, err
+	}
+	if quota.Status.InFlightPulls == int32(numPulling) {
+		return ctrl.Result{}, nil
+	}
+
+	quota.Status.InFlightPulls = int32(numPulling)
+	err = r.Status().Update(ctx, quota)
+	if err != nil {
+		logger.Error(err, "failed to update status")
+		return ctrl.Result{}, err
+	}
+	return ctrl.Result{}, nil
+}
+
+// countPullingPods returns the number of the released pods pulling images in the namespace.
+// The pods are classified in the same way as the pod controller does.
+func countPullingPods(ctx context.Context, c client.Reader, namespace string) (int, error) {
+	cfg, err := loadConfig(ctx, c)
+	if err != nil {
+		return 0, err
+	}
+	pods := &corev1.PodList{}
+	err = c.List(ctx, pods, client.InNamespace(namespace), client.MatchingFields{constants.ReleasedPodPhaseField: string(corev1.PodPending)})
+	if err != nil {
+		return 0, err
+	}
+	if len(pods.Items) == 0 {
+		return 0, nil
+	}
+	// only the images on the nodes of the pods are needed.
+	nodeList := &corev1.NodeList{}
+	err = c.List(ctx, nodeList)
+	if err != nil {
+		return 0, err
+	}
+	nodes := slices.DeleteFunc(nodeList.Items, func(node corev1.Node) bool {
+		return !slices.ContainsFunc(pods.Items, func(pod corev1.Pod) bool {
+			return pod.Spec.NodeName == node.Name
+		})
+	})
+	imageSets, _, err := listNodeImages(ctx, c, nodes, cfg)
+	if err != nil {
+		return 0, err
+	}
+
+	numPulling := 0
+	for _, pod := range pods.Items {
+		if state, _ := classifyReleasedPod(&pod, imageSets); state == releasedPulling {
+			numPulling += 1
+		}
+	}
+	return numPulling, nil
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *CatGateQuotaReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&catgatev1alpha1.CatGateQuota{}).
+		// only the changes of the pods that may change the number of the pulls are watched.
+		Watches(&corev1.Pod{}, handler.EnqueueRequestsFromMapFunc(r.quotaRequests), builder.WithPredicates(predicate.Funcs{
+			CreateFunc: func(e event.CreateEvent) bool { return hasImagesHash(e.Object) },
+			UpdateFunc: func(e event.UpdateEvent) bool {
+				return hasImagesHash(e.ObjectNew) && pullStateChanged(e.ObjectOld, e.ObjectNew)
+			},
+			DeleteFunc:  func(e event.DeleteEvent) bool { return hasImagesHash(e.Object) },
+			GenericFunc: func(e event.GenericEvent) bool { return hasImagesHash(e.Object) },
+		})).
+		Complete(r)
+}
+
+// hasImagesHash returns true if the pod has been gated by cat-gate.
+func hasImagesHash(obj client.Object) bool {
+	_, ok := obj.GetAnnotations()[constants.CatGateImagesHashAnnotation]
+	return ok
+}
+
+// pullStateChanged returns true if the pod may have changed whether it is pulling images.
+func pullStateChanged(oldObj, newObj client.Object) bool {
+	oldPod, ok := oldObj.(*corev1.Pod)
+	if !ok {
+		return true
+	}
+	newPod, ok := newObj.(*corev1.Pod)
+	if !ok {
+		return true
+	}
+	// the running pods are not pulling, so their updates do not matter.
+	if oldPod.Status.Phase != corev1.PodPending && newPod.Status.Phase != corev1.PodPending {
+		return false
+	}
+	return existsSchedulingGate(oldPod) != existsSchedulingGate(newPod) ||
+		oldPod.Status.Phase != newPod.Status.Phase ||
+		oldPod.Spec.NodeName != newPod.Spec.NodeName ||
+		!equality.Semantic.DeepEqual(oldPod.Status.Conditions, newPod.Status.Conditions) ||
+		!equality.Semantic.DeepEqual(oldPod.Status.InitContainerStatuses, newPod.Status.InitContainerStatuses) ||
+		!equality.Semantic.DeepEqual(oldPod.Status.ContainerStatuses, newPod.Status.ContainerStatuses)
+}
+
+func (r *CatGateQuotaReconciler) quotaRequests(ctx context.Context, obj client.Object) []reconcile.Request {
+	logger := log.FromContext(ctx)
+
+	quotas := &catgatev1alpha1.CatGateQuotaList{}
+	err := r.List(ctx, quotas, client.InNamespace(obj.GetNamespace()))
+	if err != nil {
+		logger.Error(err, "failed to list quotas")
+		return nil
+	}
+
+	var requests []reconcile.Request
+	for _, quota := range quotas.Items {
+		requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&quota)})
+	}
+	return requests
+}
@@ -0,0 +1,308 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	catgatev1alpha1 "github.com/cybozu-go/cat-gate/api/v1alpha1"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+var _ = Describe("CatGateQuota controller", func() {
+
+	ctx := context.Background()
+
+	It("should limit the number of pulls in the namespace and report the usage", func() {
+		testName := "quota"
+		namespace := &corev1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: testName,
+			},
+		}
+		err := k8sClient.Create(ctx, namespace)
+		Expect(err).NotTo(HaveOccurred())
+
+		minimumCapacity := int32(10)
+		profile := &catgatev1alpha1.CatGateProfile{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: testName,
+				Name:      "wide",
+			},
+			Spec: catgatev1alpha1.CatGateProfileSpec{
+				MinimumCapacity: &minimumCapacity,
+			},
+		}
+		err = k8sClient.Create(ctx, profile)
+		Expect(err).NotTo(HaveOccurred())
+
+		quota := &catgatev1alpha1.CatGateQuota{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: testName,
+				Name:      "pulls",
+			},
+			Spec: catgatev1alpha1.CatGateQuotaSpec{
+				MaxInFlightPulls: 2,
+			},
+		}
+		err = k8sClient.Create(ctx, quota)
+		Expect(err).NotTo(HaveOccurred())
+
+		for i := 0; i < 5; i++ {
+			createNewPod(testName, i)
+		}
+
+		pods := &corev1.PodList{}
+		Eventually(func(g Gomega) {
+			err := k8sClient.List(ctx, pods, &client.ListOptions{Namespace: testName})
+			g.Expect(err).NotTo(HaveOccurred())
+			numSchedulable := 0
+			for _, pod := range pods.Items {
+				if !existsSchedulingGate(&pod) {
+					numSchedulable += 1
+				}
+			}
+			g.Expect(numSchedulable).To(Equal(2))
+		}).Should(Succeed())
+		Consistently(func(g Gomega) {
+			err := k8sClient.List(ctx, pods, &client.ListOptions{Namespace: testName})
+			g.Expect(err).NotTo(HaveOccurred())
+			numSchedulable := 0
+			for _, pod := range pods.Items {
+				if !existsSchedulingGate(&pod) {
+					numSchedulable += 1
+				}
+			}
+			g.Expect(numSchedulable).To(Equal(2))
+		}, "3s").Should(Succeed())
+
+		Eventually(func(g Gomega) {
+			err := k8sClient.Get(ctx, client.ObjectKeyFromObject(quota), quota)
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(quota.Status.InFlightPulls).To(BeEquivalentTo(2))
+		}).Should(Succeed())
+	})
+
+	It("should not hold the pods of the other namespaces behind the pods of the namespace at its quota", func() {
+		testName := "quota-queue"
+		limited := testName + "-limited"
+		other := testName + "-other"
+		for _, name := range []string{limited, other} {
+			namespace := &corev1.Namespace{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: name,
+				},
+			}
+			err := k8sClient.Create(ctx, namespace)
+			Expect(err).NotTo(HaveOccurred())
+
+			minimumCapacity := int32(10)
+			profile := &catgatev1alpha1.CatGateProfile{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace: name,
+					Name:      "wide",
+				},
+				Spec: catgatev1alpha1.CatGateProfileSpec{
+					MinimumCapacity: &minimumCapacity,
+				},
+			}
+			err = k8sClient.Create(ctx, profile)
+			Expect(err).NotTo(HaveOccurred())
+		}
+
+		// the namespaces belong to the same tenant, so their pods are ordered together.
+		updateConfig(func(spec *catgatev1alpha1.CatGateConfigSpec) {
+			spec.TenantLabel = "tenant"
+		})
+		DeferCleanup(func() {
+			updateConfig(func(spec *catgatev1alpha1.CatGateConfigSpec) {
+				spec.TenantLabel = ""
+			})
+		})
+
+		quota := &catgatev1alpha1.CatGateQuota{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: limited,
+				Name:      "pulls",
+			},
+			Spec: catgatev1alpha1.CatGateQuotaSpec{
+				MaxInFlightPulls: 1,
+			},
+		}
+		err := k8sClient.Create(ctx, quota)
+		Expect(err).NotTo(HaveOccurred())
+
+		countReleased := func(g Gomega, namespace string) int {
+			pods := &corev1.PodList{}
+			err := k8sClient.List(ctx, pods, &client.ListOptions{Namespace: namespace})
+			g.Expect(err).NotTo(HaveOccurred())
+			numSchedulable := 0
+			for _, pod := range pods.Items {
+				if !existsSchedulingGate(&pod) {
+					numSchedulable += 1
+				}
+			}
+			return numSchedulable
+		}
+		// the pods have the same images hash and the same tenant.
+		sameImagesAndTenant := func(pod *corev1.Pod) {
+			pod.Labels = map[string]string{"tenant": testName}
+			pod.Spec.InitContainers[0].Image = testName + ".example.com/sample1-image:1.0.0"
+			pod.Spec.Containers[0].Image = testName + ".example.com/sample2-image:1.0.0"
+		}
+
+		for i := 0; i < 12; i++ {
+			createNewPod(limited, i, sameImagesAndTenant)
+		}
+		Eventually(func(g Gomega) {
+			g.Expect(countReleased(g, limited)).To(Equal(1))
+		}).Should(Succeed())
+
+		// the pods come after the 11 gated pods of the limited namespace, which is more than the capacity.
+		for i := 0; i < 2; i++ {
+			createNewPod(other, i, sameImagesAndTenant)
+		}
+		Eventually(func(g Gomega) {
+			g.Expect(countReleased(g, other)).To(Equal(2))
+		}).Should(Succeed())
+		Consistently(func(g Gomega) {
+			g.Expect(countReleased(g, limited)).To(Equal(1))
+		}, "3s").Should(Succeed())
+	})
+
+	It("should report the pulls in the same way as it limits them", func() {
+		testName := "quota-sighting"
+		namespace := &corev1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: testName,
+			},
+		}
+		err := k8sClient.Create(ctx, namespace)
+		Expect(err).NotTo(HaveOccurred())
+
+		minimumCapacity := int32(10)
+		profile := &catgatev1alpha1.CatGateProfile{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: testName,
+				Name:      "wide",
+			},
+			Spec: catgatev1alpha1.CatGateProfileSpec{
+				MinimumCapacity: &minimumCapacity,
+			},
+		}
+		err = k8sClient.Create(ctx, profile)
+		Expect(err).NotTo(HaveOccurred())
+
+		updateConfig(func(spec *catgatev1alpha1.CatGateConfigSpec) {
+			spec.ImageSightingTTLSeconds = 60
+		})
+		DeferCleanup(func() {
+			updateConfig(func(spec *catgatev1alpha1.CatGateConfigSpec) {
+				spec.ImageSightingTTLSeconds = 0
+			})
+		})
+
+		quota := &catgatev1alpha1.CatGateQuota{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: testName,
+				Name:      "pulls",
+			},
+			Spec: catgatev1alpha1.CatGateQuotaSpec{
+				MaxInFlightPulls: 1,
+			},
+		}
+		err = k8sClient.Create(ctx, quota)
+		Expect(err).NotTo(HaveOccurred())
+
+		countReleased := func(g Gomega) int {
+			pods := &corev1.PodList{}
+			err := k8sClient.List(ctx, pods, &client.ListOptions{Namespace: testName})
+			g.Expect(err).NotTo(HaveOccurred())
+			numSchedulable := 0
+			for _, pod := range pods.Items {
+				if !existsSchedulingGate(&pod) {
+					numSchedulable += 1
+				}
+			}
+			return numSchedulable
+		}
+
+		// the node does not report the images in its status.
+		nodeName := fmt.Sprintf("%s-node-%d", testName, 0)
+		createNewNode(testName, 0)
+		for i := 0; i < 4; i++ {
+			createNewPod(testName, i)
+		}
+		Eventually(func(g Gomega) {
+			g.Expect(countReleased(g)).To(Equal(1))
+		}).Should(Succeed())
+
+		// the running pod shows that the node has the images.
+		pod := &corev1.Pod{}
+		err = k8sClient.Get(ctx, client.ObjectKey{Name: fmt.Sprintf("%s-pod-%d", testName, 0), Namespace: testName}, pod)
+		Expect(err).NotTo(HaveOccurred())
+		bindPod(pod, nodeName)
+		err = k8sClient.Get(ctx, client.ObjectKeyFromObject(pod), pod)
+		Expect(err).NotTo(HaveOccurred())
+		pod.Status.Phase = corev1.PodRunning
+		pod.Status.InitContainerStatuses = []corev1.ContainerStatus{
+			{
+				Name:    pod.Spec.InitContainers[0].Name,
+				Image:   pod.Spec.InitContainers[0].Image,
+				ImageID: "sha256:1",
+				State:   corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{}},
+			},
+		}
+		pod.Status.ContainerStatuses = []corev1.ContainerStatus{
+			{
+				Name:    pod.Spec.Containers[0].Name,
+				Image:   pod.Spec.Containers[0].Image,
+				ImageID: "sha256:2",
+				State:   corev1.ContainerState{Running: &corev1.ContainerStateRunning{}},
+			},
+		}
+		err = k8sClient.Status().Update(ctx, pod)
+		Expect(err).NotTo(HaveOccurred())
+		Eventually(func(g Gomega) {
+			g.Expect(countReleased(g)).To(Equal(2))
+		}).Should(Succeed())
+
+		// the pod bound to the node pulls nothing, so another pod is released.
+		err = k8sClient.Get(ctx, client.ObjectKey{Name: fmt.Sprintf("%s-pod-%d", testName, 1), Namespace: testName}, pod)
+		Expect(err).NotTo(HaveOccurred())
+		bindPod(pod, nodeName)
+		Eventually(func(g Gomega) {
+			g.Expect(countReleased(g)).To(Equal(3))
+		}).Should(Succeed())
+
+		// only the last released pod is pulling images.
+		Eventually(func(g Gomega) {
+			err := k8sClient.Get(ctx, client.ObjectKeyFromObject(quota), quota)
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(quota.Status.InFlightPulls).To(BeEquivalentTo(1))
+		}).Should(Succeed())
+		Consistently(func(g Gomega) {
+			g.Expect(countReleased(g)).To(Equal(3))
+			err := k8sClient.Get(ctx, client.ObjectKeyFromObject(quota), quota)
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(quota.Status.InFlightPulls).To(BeEquivalentTo(1))
+		}, "3s").Should(Succeed())
+	})
+
+	It("should reject CatGateQuota with an invalid limit", func() {
+		quota := &catgatev1alpha1.CatGateQuota{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: "default",
+				Name:      "invalid",
+			},
+			Spec: catgatev1alpha1.CatGateQuotaSpec{
+				MaxInFlightPulls: 0,
+			},
+		}
+		err := k8sClient.Create(ctx, quota)
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -0,0 +1,143 @@
+package controller
+
+import (
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// CircuitBreakers records the circuit breaker of each images hash.
+var CircuitBreakers = sync.Map{}
+
+type breakerState int
+
+const (
+	// breakerClosed is the state in which the scheduling gates are removed as usual.
+	breakerClosed breakerState = iota
+	// breakerOpen is the state in which no scheduling gate is removed because of pull failures.
+	breakerOpen
+	// breakerHalfOpen is the state in which a single pod is released to probe whether the images can be pulled.
+	breakerHalfOpen
+)
+
+// probeResult is the outcome of the pod released in the half-open state.
+type probeResult int
+
+const (
+	probePulling probeResult = iota
+	probeSucceeded
+	probeFailed
+	probeGone
+)
+
+// CircuitBreaker stops the removal of the scheduling gates of the pods with the same images
+// when the images fail to be pulled repeatedly, e.g. because of a wrong tag.
+type CircuitBreaker struct {
+	mu        sync.Mutex
+	state     breakerState
+	openedAt  time.Time
+	updatedAt time.Time
+	probe     types.NamespacedName
+	// the time when the probe was released.
+	probeStartedAt time.Time
+	// the pods that had failed when the breaker was closed. They are retrying with their own backoff,
+	// so they should not open the breaker again.
+	acknowledged map[types.UID]struct{}
+}
+
+// loadCircuitBreaker returns the circuit breaker for the images hash.
+func loadCircuitBreaker(hash string) *CircuitBreaker {
+	value, _ := CircuitBreakers.LoadOrStore(hash, &CircuitBreaker{})
+	return value.(*CircuitBreaker)
+}
+
+// LastUpdated returns the last time the breaker was evaluated.
+func (cb *CircuitBreaker) LastUpdated() time.Time {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	return cb.updatedAt
+}
+
+// Probe returns the pod released as the probe and the time when it was released, or the zero values if there is none.
+func (cb *CircuitBreaker) Probe() (types.NamespacedName, time.Time) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	return cb.probe, cb.probeStartedAt
+}
+
+// observe advances the state with the pods failing to pull images and the result of the probe.
+// It returns true for opened when the breaker has just been opened, and true for closed when it has just been closed.
+func (cb *CircuitBreaker) observe(now time.Time, failing []types.UID, probe probeResult, threshold int) (opened, closed bool) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	cb.updatedAt = now
+
+	switch cb.state {
+	case breakerClosed:
+		numFailures := 0
+		for _, uid := range failing {
+			if _, ok := cb.acknowledged[uid]; !ok {
+				numFailures += 1
+			}
+		}
+		if numFailures >= threshold {
+			cb.state = breakerOpen
+			cb.openedAt = now
+			return true, false
+		}
+	case breakerHalfOpen:
+		if cb.probe == (types.NamespacedName{}) {
+			return false, false
+		}
+		switch probe {
+		case probeFailed:
+			cb.state = breakerOpen
+			cb.openedAt = now
+			cb.probe = types.NamespacedName{}
+			return true, false
+		case probeSucceeded:
+			cb.state = breakerClosed
+			cb.probe = types.NamespacedName{}
+			cb.acknowledged = make(map[types.UID]struct{}, len(failing))
+			for _, uid := range failing {
+				cb.acknowledged[uid] = struct{}{}
+			}
+			return false, true
+		case probeGone:
+			// release another pod as the probe.
+			cb.probe = types.NamespacedName{}
+		}
+	}
+	return false, false
+}
+
+// allow returns true if a scheduling gate can be removed.
+// It returns true for probe if the removal is the probe of the half-open state.
+func (cb *CircuitBreaker) allow(now time.Time, probeInterval time.Duration) (allowed, probe bool) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	switch cb.state {
+	case breakerOpen:
+		if now.Sub(cb.openedAt) < probeInterval {
+			return false, false
+		}
+		cb.state = breakerHalfOpen
+		return true, true
+	case breakerHalfOpen:
+		if cb.probe == (types.NamespacedName{}) {
+			return true, true
+		}
+		return false, false
+	}
+	return true, false
+}
+
+// startProbe records the pod released as the probe.
+func (cb *CircuitBreaker) startProbe(now time.Time, pod types.NamespacedName) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	cb.probe = pod
+	cb.probeStartedAt = now
+}
@@ -0,0 +1,126 @@
+package controller
+
+import (
+	"context"
+
+	catgatev1alpha1 "github.com/cybozu-go/cat-gate/api/v1alpha1"
+	"github.com/cybozu-go/cat-gate/internal/constants"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// default values of the parameters used when CatGateConfig does not exist or leaves them empty.
+const (
+	defaultScaleRate                    = 2
+	defaultMinimumCapacity              = 1
+	defaultRequeueSeconds               = 10
+	defaultGateRemovalDelayMilliSeconds = 10
+	defaultCriticalPriority             = 2000000000 // system-cluster-critical
+	defaultPullFailureThreshold         = 3
+	defaultPullFailureProbeSeconds      = 60
+	defaultRegistryBackoffSeconds       = 30
+	defaultRegistryBackoffMaxSeconds    = 600
+)
+
+// effectiveConfig returns the parameters in effect for the given CatGateConfig.
+// cfg may be nil when CatGateConfig does not exist.
+func effectiveConfig(cfg *catgatev1alpha1.CatGateConfig) *catgatev1alpha1.CatGateConfigSpec {
+	spec := &catgatev1alpha1.CatGateConfigSpec{}
+	if cfg != nil {
+		spec = cfg.Spec.DeepCopy()
+	}
+
+	if spec.ScaleRate == 0 {
+		spec.ScaleRate = defaultScaleRate
+	}
+	if spec.MinimumCapacity == 0 {
+		spec.MinimumCapacity = defaultMinimumCapacity
+	}
+	if spec.RequeueSeconds == 0 {
+		spec.RequeueSeconds = defaultRequeueSeconds
+	}
+	if spec.GateRemovalDelayMilliSeconds == 0 {
+		spec.GateRemovalDelayMilliSeconds = defaultGateRemovalDelayMilliSeconds
+	}
+	if spec.CriticalPriority == 0 {
+		spec.CriticalPriority = defaultCriticalPriority
+	}
+	if spec.PullFailureThreshold == 0 {
+		spec.PullFailureThreshold = defaultPullFailureThreshold
+	}
+	if spec.PullFailureProbeSeconds == 0 {
+		spec.PullFailureProbeSeconds = defaultPullFailureProbeSeconds
+	}
+	if spec.RegistryBackoffSeconds == 0 {
+		spec.RegistryBackoffSeconds = defaultRegistryBackoffSeconds
+	}
+	if spec.RegistryBackoffMaxSeconds == 0 {
+		spec.RegistryBackoffMaxSeconds = defaultRegistryBackoffMaxSeconds
+	}
+	return spec
+}
+
+// loadConfig reads CatGateConfig from the cache and returns the parameters in effect.
+func loadConfig(ctx context.Context, c client.Reader) (*catgatev1alpha1.CatGateConfigSpec, error) {
+	cfg := &catgatev1alpha1.CatGateConfig{}
+	err := c.Get(ctx, client.ObjectKey{Name: catgatev1alpha1.CatGateConfigName}, cfg)
+	if errors.IsNotFound(err) {
+		return effectiveConfig(nil), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return effectiveConfig(cfg), nil
+}
+
+// applyProfile overrides the parameters with the CatGateProfile stamped on the pod.
+func applyProfile(ctx context.Context, c client.Reader, cfg *catgatev1alpha1.CatGateConfigSpec, pod *corev1.Pod) (*catgatev1alpha1.CatGateConfigSpec, error) {
+	name, ok := pod.Annotations[constants.CatGateProfileAnnotation]
+	if !ok {
+		return cfg, nil
+	}
+
+	profile := &catgatev1alpha1.CatGateProfile{}
+	err := c.Get(ctx, client.ObjectKey{Namespace: pod.Namespace, Name: name}, profile)
+	if errors.IsNotFound(err) {
+		log.FromContext(ctx).V(constants.LevelWarning).Info("profile not found", "profile", name)
+		return cfg, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	params := cfg.DeepCopy()
+	if profile.Spec.ScaleRate != nil {
+		params.ScaleRate = *profile.Spec.ScaleRate
+	}
+	if profile.Spec.MinimumCapacity != nil {
+		params.MinimumCapacity = *profile.Spec.MinimumCapacity
+	}
+	if profile.Spec.RequeueSeconds != nil {
+		params.RequeueSeconds = *profile.Spec.RequeueSeconds
+	}
+	if profile.Spec.MaxGateHoldSeconds != nil {
+		params.MaxGateHoldSeconds = *profile.Spec.MaxGateHoldSeconds
+	}
+	if profile.Spec.TargetWaitSeconds != nil {
+		params.TargetWaitSeconds = *profile.Spec.TargetWaitSeconds
+	}
+	return params, nil
+}
+
+// excludedNodeSelector returns the selector of the nodes excluded from the capacity calculation.
+func excludedNodeSelector(ctx context.Context, cfg *catgatev1alpha1.CatGateConfigSpec) labels.Selector {
+	// LabelSelectorAsSelector returns labels.Nothing() for nil.
+	selector, err := metav1.LabelSelectorAsSelector(cfg.ExcludedNodeSelector)
+	if err != nil {
+		// an invalid selector must not stop the removal of scheduling gates.
+		log.FromContext(ctx).Error(err, "ignore invalid excluded node selector")
+		return labels.Nothing()
+	}
+	return selector
+}
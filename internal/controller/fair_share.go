@@ -0,0 +1,150 @@
+package controller
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	catgatev1alpha1 "github.com/cybozu-go/cat-gate/api/v1alpha1"
+	"github.com/cybozu-go/cat-gate/internal/constants"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// TenantDemands records the tenants whose pods are waiting for the capacity across the cluster or of a registry.
+var TenantDemands = sync.Map{}
+
+// clusterPool is the pool of the capacity across the cluster.
+// The pools of the capacities of the registries are their hosts.
+const clusterPool = ""
+
+// tenantDemandKey identifies the demand of a tenant for the capacity of a pool.
+type tenantDemandKey struct {
+	pool   string
+	tenant string
+}
+
+// TenantDemand is the latest demand of a tenant for the capacity of a pool.
+type TenantDemand struct {
+	mu        sync.Mutex
+	weight    int
+	interval  time.Duration
+	updatedAt time.Time
+}
+
+// loadTenantDemand returns the demand of the tenant for the capacity of the pool.
+func loadTenantDemand(pool, tenant string) *TenantDemand {
+	value, _ := TenantDemands.LoadOrStore(tenantDemandKey{pool: pool, tenant: tenant}, &TenantDemand{})
+	return value.(*TenantDemand)
+}
+
+// LastUpdated returns the last time a pod of the tenant waited for the capacity.
+func (d *TenantDemand) LastUpdated() time.Time {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.updatedAt
+}
+
+// observe records that a pod of the tenant waits for the capacity and is re-evaluated every interval.
+func (d *TenantDemand) observe(now time.Time, weight int, interval time.Duration) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.weight = weight
+	d.interval = interval
+	d.updatedAt = now
+}
+
+// activeWeight returns the weight of the tenant if its pods are still waiting for the capacity.
+// A tenant is regarded as waiting until its pods miss two re-evaluations.
+func (d *TenantDemand) activeWeight(now time.Time) (int, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if now.Sub(d.updatedAt) > 2*d.interval {
+		return 0, false
+	}
+	return d.weight, true
+}
+
+// activeWeights returns the weights of the tenants waiting for the capacity of the pool, and their total.
+func activeWeights(now time.Time, pool string) (map[string]int, int) {
+	weights := make(map[string]int)
+	total := 0
+	TenantDemands.Range(func(key, value interface{}) bool {
+		k := key.(tenantDemandKey)
+		if k.pool != pool {
+			return true
+		}
+		if weight, ok := value.(*TenantDemand).activeWeight(now); ok {
+			weights[k.tenant] = weight
+			total += weight
+		}
+		return true
+	})
+	return weights, total
+}
+
+// fairShares divides the capacity of the pool among the waiting tenants in proportion to their weights.
+// The pulls of the tenants that are not waiting are subtracted from the capacity beforehand.
+// Every waiting tenant gets at least one pull.
+func fairShares(now time.Time, pool string, capacity int, numPulling map[string]int) map[string]int {
+	weights, total := activeWeights(now, pool)
+
+	available := capacity
+	for tenant, n := range numPulling {
+		if _, ok := weights[tenant]; !ok {
+			available -= n
+		}
+	}
+	shares := make(map[string]int, len(weights))
+	for tenant, weight := range weights {
+		shares[tenant] = max(available*weight/total, 1)
+	}
+	return shares
+}
+
+// othersUnderShare returns true if a tenant other than the given one pulls less than its share.
+func othersUnderShare(shares, numPulling map[string]int, tenant string) bool {
+	for other, share := range shares {
+		if other != tenant && numPulling[other] < share {
+			return true
+		}
+	}
+	return false
+}
+
+// tenantOf returns the tenant of the pod, i.e. the value of the tenant label or the namespace of the pod.
+func tenantOf(pod *corev1.Pod, tenantLabel string) string {
+	if tenantLabel != "" {
+		if tenant, ok := pod.Labels[tenantLabel]; ok {
+			return tenant
+		}
+	}
+	return pod.Namespace
+}
+
+// tenantWeight returns the weight of the tenant from CatGateConfig, or from the annotation of the namespace of the pod.
+func (r *PodReconciler) tenantWeight(ctx context.Context, cfg *catgatev1alpha1.CatGateConfigSpec, pod *corev1.Pod, tenant string) (int, error) {
+	for _, tw := range cfg.TenantWeights {
+		if tw.Name == tenant {
+			return int(tw.Weight), nil
+		}
+	}
+
+	ns := &corev1.Namespace{}
+	err := r.Get(ctx, client.ObjectKey{Name: pod.Namespace}, ns)
+	if err != nil {
+		return 0, err
+	}
+	value, ok := ns.Annotations[constants.CatGateWeightAnnotation]
+	if !ok {
+		return 1, nil
+	}
+	weight, err := strconv.Atoi(value)
+	if err != nil || weight < 1 {
+		log.FromContext(ctx).V(constants.LevelWarning).Info("ignore the invalid weight of the namespace", "namespace", pod.Namespace, "weight", value)
+		return 1, nil
+	}
+	return weight, nil
+}
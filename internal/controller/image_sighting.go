@@ -0,0 +1,62 @@
+package controller
+
+import (
+	"sync"
+	"time"
+)
+
+// ImageSightings records the images seen on each node other than in the node status.
+var ImageSightings = sync.Map{}
+
+// ImageSighting is the last time each image was seen on a node.
+// The kubelet reports a limited number of images in the node status,
+// so the images are also inferred from the running pods and the events of the kubelet.
+type ImageSighting struct {
+	mu        sync.Mutex
+	seenAt    map[string]time.Time
+	updatedAt time.Time
+}
+
+// loadImageSighting returns the image sighting of the node.
+func loadImageSighting(node string) *ImageSighting {
+	value, _ := ImageSightings.LoadOrStore(node, &ImageSighting{seenAt: make(map[string]time.Time)})
+	return value.(*ImageSighting)
+}
+
+// LastUpdated returns the last time an image was seen on the node.
+func (s *ImageSighting) LastUpdated() time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.updatedAt
+}
+
+// observe records that the images are on the node at the time.
+// The time of an image only moves forward, so that a replayed old sighting does not expire a newer one early.
+func (s *ImageSighting) observe(seenAt time.Time, images ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, image := range images {
+		if seenAt.After(s.seenAt[image]) {
+			s.seenAt[image] = seenAt
+		}
+	}
+	if seenAt.After(s.updatedAt) {
+		s.updatedAt = seenAt
+	}
+}
+
+// images returns the images seen on the node within the ttl.
+// The images seen before the ttl are forgotten.
+func (s *ImageSighting) images(now time.Time, ttl time.Duration) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var images []string
+	for image, seenAt := range s.seenAt {
+		if now.Sub(seenAt) > ttl {
+			delete(s.seenAt, image)
+			continue
+		}
+		images = append(images, image)
+	}
+	return images
+}
@@ -0,0 +1,161 @@
+package controller
+
+import (
+	"context"
+	"regexp"
+	"slices"
+	"time"
+
+	catgatev1alpha1 "github.com/cybozu-go/cat-gate/api/v1alpha1"
+	"github.com/cybozu-go/cat-gate/internal/constants"
+	"github.com/cybozu-go/cat-gate/internal/imageref"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// the reason of the events that the kubelet emits when an image is pulled or already present.
+const reasonPulled = "Pulled"
+
+// pulledImageMessage matches the image in the messages of the Pulled events, e.g.
+// `Successfully pulled image "nginx:1.25" in 1.2s` and `Container image "nginx:1.25" already present on machine`.
+var pulledImageMessage = regexp.MustCompile(`image "([^"]+)"`)
+
+// RunningPodReconciler records the images of the running pods as the images on their nodes.
+type RunningPodReconciler struct {
+	client.Client
+	Scheme *runtime.Scheme
+}
+
+// Reconcile records the images of the containers that have been started.
+func (r *RunningPodReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	cfg, err := loadConfig(ctx, r)
+	if err != nil {
+		logger.Error(err, "failed to load config")
+		return ctrl.Result{}, err
+	}
+	if cfg.ImageSightingTTLSeconds == 0 {
+		return ctrl.Result{}, nil
+	}
+
+	pod := &corev1.Pod{}
+	err = r.Get(ctx, req.NamespacedName, pod)
+	if err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	if !isRunningOnNode(pod) {
+		return ctrl.Result{}, nil
+	}
+
+	// the images of the pod are on the node unless they are still being pulled.
+	pulling := pullingImages(pod)
+	images := slices.DeleteFunc(podImages(pod), func(image string) bool {
+		return slices.Contains(pulling, image)
+	})
+	loadImageSighting(pod.Spec.NodeName).observe(time.Now(), images...)
+	// the pod may not be updated while it is running, so the images are recorded again before they expire.
+	return ctrl.Result{
+		RequeueAfter: time.Duration(cfg.ImageSightingTTLSeconds) * time.Second / 2,
+	}, nil
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *RunningPodReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		Named("running-pod").
+		For(&corev1.Pod{}, builder.WithPredicates(predicate.NewPredicateFuncs(func(obj client.Object) bool {
+			pod, ok := obj.(*corev1.Pod)
+			return ok && isRunningOnNode(pod)
+		}))).
+		// the running pods are recorded when the TTL is turned on, without waiting for their updates.
+		Watches(&catgatev1alpha1.CatGateConfig{}, handler.EnqueueRequestsFromMapFunc(r.runningPodRequests),
+			builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		Complete(r)
+}
+
+func (r *RunningPodReconciler) runningPodRequests(ctx context.Context, _ client.Object) []reconcile.Request {
+	logger := log.FromContext(ctx)
+
+	pods := &corev1.PodList{}
+	err := r.List(ctx, pods)
+	if err != nil {
+		logger.Error(err, "failed to list pods")
+		return nil
+	}
+
+	var requests []reconcile.Request
+	for _, pod := range pods.Items {
+		if isRunningOnNode(&pod) {
+			requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&pod)})
+		}
+	}
+	return requests
+}
+
+// isRunningOnNode returns true if the pod is running on a node.
+func isRunningOnNode(pod *corev1.Pod) bool {
+	return pod.Spec.NodeName != "" && pod.Status.Phase == corev1.PodRunning
+}
+
+// PulledEventReconciler records the images of the Pulled events as the images on the nodes that emitted them.
+type PulledEventReconciler struct {
+	client.Client
+	Scheme *runtime.Scheme
+}
+
+//+kubebuilder:rbac:groups=core,resources=events,verbs=get;list;watch
+
+// Reconcile records the image of the Pulled event.
+func (r *PulledEventReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	cfg, err := loadConfig(ctx, r)
+	if err != nil {
+		logger.Error(err, "failed to load config")
+		return ctrl.Result{}, err
+	}
+	if cfg.ImageSightingTTLSeconds == 0 {
+		return ctrl.Result{}, nil
+	}
+
+	event := &corev1.Event{}
+	err = r.Get(ctx, req.NamespacedName, event)
+	if err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+
+	node := event.Source.Host
+	match := pulledImageMessage.FindStringSubmatch(event.Message)
+	if node == "" || match == nil {
+		logger.V(constants.LevelDebug).Info("ignore the Pulled event without the node or the image", "message", event.Message)
+		return ctrl.Result{}, nil
+	}
+	seenAt := event.LastTimestamp.Time
+	if seenAt.IsZero() {
+		seenAt = event.EventTime.Time
+	}
+	if seenAt.IsZero() {
+		seenAt = event.CreationTimestamp.Time
+	}
+	loadImageSighting(node).observe(seenAt, imageref.Normalize(match[1]))
+	return ctrl.Result{}, nil
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *PulledEventReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		Named("pulled-event").
+		For(&corev1.Event{}, builder.WithPredicates(predicate.NewPredicateFuncs(func(obj client.Object) bool {
+			event, ok := obj.(*corev1.Event)
+			return ok && event.Reason == reasonPulled && event.InvolvedObject.Kind == "Pod"
+		}))).
+		Complete(r)
+}
@@ -0,0 +1,68 @@
+package controller
+
+import (
+	"sync"
+	"time"
+
+	catgatev1alpha1 "github.com/cybozu-go/cat-gate/api/v1alpha1"
+	"github.com/cybozu-go/cat-gate/internal/imageref"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// NodeImageCaches records the normalized images on each node, so that they are not normalized on every reconcile.
+var NodeImageCaches = sync.Map{}
+
+// NodeImageCache is the normalized images on a node.
+// They are normalized again only when the node or its inventory changes.
+type NodeImageCache struct {
+	mu               sync.Mutex
+	nodeVersion      string
+	inventoryVersion string
+	images           imageref.Set
+	sizes            map[string]int64
+	updatedAt        time.Time
+}
+
+// loadNodeImageCache returns the image cache of the node.
+func loadNodeImageCache(node string) *NodeImageCache {
+	value, _ := NodeImageCaches.LoadOrStore(node, &NodeImageCache{})
+	return value.(*NodeImageCache)
+}
+
+// LastUpdated returns the last time the cache was read.
+func (c *NodeImageCache) LastUpdated() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.updatedAt
+}
+
+// get returns the images on the node and their sizes.
+// inventory is nil if the node has no fresh inventory. The returned values must not be modified.
+func (c *NodeImageCache) get(now time.Time, node *corev1.Node, inventory *catgatev1alpha1.NodeImageInventory) (imageref.Set, map[string]int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.updatedAt = now
+
+	inventoryVersion := ""
+	if inventory != nil {
+		inventoryVersion = inventory.ResourceVersion
+	}
+	if c.images != nil && c.nodeVersion == node.ResourceVersion && c.inventoryVersion == inventoryVersion {
+		return c.images, c.sizes
+	}
+
+	images := nodeImages(node, inventory)
+	c.images = nodeImageSet(images)
+	c.sizes = make(map[string]int64)
+	for _, image := range images {
+		for _, name := range image.Names {
+			name = imageref.Normalize(name)
+			if image.SizeBytes > c.sizes[name] {
+				c.sizes[name] = image.SizeBytes
+			}
+		}
+	}
+	c.nodeVersion = node.ResourceVersion
+	c.inventoryVersion = inventoryVersion
+	return c.images, c.sizes
+}
@@ -0,0 +1,80 @@
+package controller
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	corev1helpers "k8s.io/component-helpers/scheduling/corev1"
+	"k8s.io/component-helpers/scheduling/corev1/nodeaffinity"
+)
+
+// the label and the taint that virtual-kubelet puts on its nodes.
+const (
+	virtualKubeletLabelKey   = "type"
+	virtualKubeletLabelValue = "virtual-kubelet"
+	virtualKubeletTaintKey   = "virtual-kubelet.io/provider"
+)
+
+// eligibleNodes returns the nodes on which the pod can be placed.
+// It applies the same filters as the NodeAffinity and TaintToleration plugins of kube-scheduler,
+// i.e. nodeSelector, required node affinity and taints with the NoSchedule and NoExecute effects.
+// The nodes that cannot pull images for any pod are dropped first, see usableNode.
+func eligibleNodes(pod *corev1.Pod, nodes []corev1.Node, excluded labels.Selector) ([]corev1.Node, error) {
+	affinity := nodeaffinity.GetRequiredNodeAffinity(pod)
+	filterTaints := func(t *corev1.Taint) bool {
+		return t.Effect == corev1.TaintEffectNoSchedule || t.Effect == corev1.TaintEffectNoExecute
+	}
+
+	var eligible []corev1.Node
+	for _, node := range nodes {
+		if !usableNode(&node, excluded) {
+			continue
+		}
+		match, err := affinity.Match(&node)
+		if err != nil {
+			return nil, err
+		}
+		if !match {
+			continue
+		}
+		if _, untolerated := corev1helpers.FindMatchingUntoleratedTaint(node.Spec.Taints, pod.Spec.Tolerations, filterTaints); untolerated {
+			continue
+		}
+		eligible = append(eligible, node)
+	}
+	return eligible, nil
+}
+
+// usableNode returns false for the nodes that should not add capacity:
+// cordoned nodes, nodes that are not ready, virtual-kubelet nodes and the nodes selected by excluded.
+// A draining node is cordoned first, so it stops adding capacity before its pods are evicted.
+func usableNode(node *corev1.Node, excluded labels.Selector) bool {
+	if node.Spec.Unschedulable {
+		return false
+	}
+	if !nodeReady(node) {
+		return false
+	}
+	if node.Labels[virtualKubeletLabelKey] == virtualKubeletLabelValue {
+		return false
+	}
+	for _, taint := range node.Spec.Taints {
+		if taint.Key == virtualKubeletTaintKey {
+			return false
+		}
+	}
+	if excluded != nil && excluded.Matches(labels.Set(node.Labels)) {
+		return false
+	}
+	return true
+}
+
+// nodeReady returns true if the Ready condition of the node is True.
+// A node without the condition has not been initialized by kubelet yet.
+func nodeReady(node *corev1.Node) bool {
+	for _, cond := range node.Status.Conditions {
+		if cond.Type == corev1.NodeReady {
+			return cond.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
@@ -18,40 +18,60 @@ package controller
 
 import (
 	"context"
+	"fmt"
+	"math"
 	"slices"
+	"sort"
 	"sync"
 	"time"
 
+	catgatev1alpha1 "github.com/cybozu-go/cat-gate/api/v1alpha1"
 	"github.com/cybozu-go/cat-gate/internal/constants"
+	"github.com/cybozu-go/cat-gate/internal/imageref"
+	"github.com/cybozu-go/cat-gate/internal/metrics"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 )
 
 // PodReconciler reconciles a Pod object
 type PodReconciler struct {
 	client.Client
-	Scheme *runtime.Scheme
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
 }
 
-// scaleRate is the rate at which scheduling gates are opened per node with image.
-const scaleRate = 2
-
-// minimumCapacity the number of scheduling gates to remove when no node have the image.
-const minimumCapacity = 1
+// the reasons of the events emitted by cat-gate.
+const (
+	eventReasonPullCircuitOpen   = "ImagePullCircuitOpen"
+	eventReasonPullCircuitClosed = "ImagePullCircuitClosed"
+	eventReasonGateHoldTimeout   = "GateHoldTimeout"
+)
 
-var requeueSeconds = 10
-var gateRemovalDelayMilliSecond = 10
+// GateRemovalHistories records the last time a scheduling gate was removed for each image.
 var GateRemovalHistories = sync.Map{}
 
 //+kubebuilder:rbac:groups=core,resources=pods,verbs=get;list;watch;update;patch
 //+kubebuilder:rbac:groups=core,resources=pods/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=core,resources=pods/finalizers,verbs=update
 //+kubebuilder:rbac:groups=core,resources=nodes,verbs=get;list;watch
+//+kubebuilder:rbac:groups=core,resources=namespaces,verbs=get;list;watch
+//+kubebuilder:rbac:groups=core,resources=events,verbs=create;patch
+//+kubebuilder:rbac:groups=cat-gate.cybozu.io,resources=catgateconfigs,verbs=get;list;watch
+//+kubebuilder:rbac:groups=cat-gate.cybozu.io,resources=catgateprofiles,verbs=get;list;watch
+//+kubebuilder:rbac:groups=cat-gate.cybozu.io,resources=catgatequotas,verbs=get;list;watch
+//+kubebuilder:rbac:groups=cat-gate.cybozu.io,resources=nodeimageinventories,verbs=get;list;watch
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
@@ -72,8 +92,7 @@ func (r *PodReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.R
 		return ctrl.Result{}, nil
 	}
 
-	annotations := reqPod.Annotations
-	if _, ok := annotations[constants.CatGateImagesHashAnnotation]; !ok {
+	if _, ok := reqPod.Annotations[constants.CatGateImagesHashAnnotation]; !ok {
 		logger.V(constants.LevelWarning).Info("pod annotation not found")
 		err := r.removeSchedulingGate(ctx, reqPod)
 		if err != nil {
@@ -82,106 +101,490 @@ func (r *PodReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.R
 		}
 		return ctrl.Result{}, nil
 	}
-	reqImagesHash := annotations[constants.CatGateImagesHashAnnotation]
 
-	// prevents removing the scheduling gate based on information before the cache is updated.
-	if value, ok := GateRemovalHistories.Load(reqImagesHash); ok {
-		lastGateRemovalTime := value.(time.Time)
-		if time.Since(lastGateRemovalTime) < time.Duration(gateRemovalDelayMilliSecond)*time.Millisecond {
-			logger.V(constants.LevelDebug).Info("perform retry processing to avoid race conditions", "lastGateRemovalTime", lastGateRemovalTime)
-			return ctrl.Result{RequeueAfter: time.Duration(gateRemovalDelayMilliSecond) * time.Millisecond}, nil
+	cfg, err := loadConfig(ctx, r)
+	if err != nil {
+		logger.Error(err, "failed to load config")
+		return ctrl.Result{}, err
+	}
+	cfg, err = applyProfile(ctx, r, cfg, reqPod)
+	if err != nil {
+		logger.Error(err, "failed to load profile")
+		return ctrl.Result{}, err
+	}
+	gateRemovalDelay := time.Duration(cfg.GateRemovalDelayMilliSeconds) * time.Millisecond
+
+	// the gates of the other controllers are removed first, e.g. when the pods are admitted by a job queue.
+	if gate, ok := awaitedGate(reqPod, cfg.RemoveAfterGates); ok {
+		logger.V(constants.LevelDebug).Info("wait for the removal of the other scheduling gate", "gate", gate)
+		if _, ok := reqPod.Annotations[constants.CatGateAwaitingGatesAnnotation]; !ok {
+			err := r.markAwaitingGates(ctx, reqPod)
+			if err != nil {
+				logger.Error(err, "failed to annotate pod")
+				return ctrl.Result{}, err
+			}
+		}
+		return ctrl.Result{
+			RequeueAfter: time.Duration(cfg.RequeueSeconds) * time.Second,
+		}, nil
+	}
+	// the hold time and the wait time of the pod are measured from the removal of the other gates.
+	if _, ok := reqPod.Annotations[constants.CatGateAwaitingGatesAnnotation]; ok {
+		err := r.restartGatedAt(ctx, reqPod, time.Now())
+		if err != nil {
+			logger.Error(err, "failed to annotate pod")
+			return ctrl.Result{}, err
 		}
 	}
 
-	var reqImageList []string
-	for _, initContainer := range reqPod.Spec.InitContainers {
-		if initContainer.Image == "" {
-			continue
+	// critical pods must not wait behind the throttle.
+	// they are counted as pulling once released, so the other pods are throttled accordingly.
+	if isCritical(reqPod, cfg.CriticalPriority) {
+		logger.Info("remove scheduling gate of the critical pod", "priority", podPriority(reqPod), "priorityClassName", reqPod.Spec.PriorityClassName)
+		err := r.removeSchedulingGate(ctx, reqPod)
+		if err != nil {
+			logger.Error(err, "failed to remove scheduling gate")
+			return ctrl.Result{}, err
+		}
+		now := time.Now()
+		for _, image := range podImages(reqPod) {
+			GateRemovalHistories.Store(image, now)
+		}
+		return ctrl.Result{}, nil
+	}
+
+	// the scheduling gate must not be held indefinitely even if the capacity never allows the pod.
+	if cfg.MaxGateHoldSeconds > 0 {
+		maxGateHold := time.Duration(cfg.MaxGateHoldSeconds) * time.Second
+		if heldFor := time.Since(gatedAt(reqPod)); heldFor >= maxGateHold {
+			logger.Info("remove scheduling gate because the pod has been gated for too long", "heldFor", heldFor)
+			err := r.removeSchedulingGate(ctx, reqPod)
+			if err != nil {
+				logger.Error(err, "failed to remove scheduling gate")
+				return ctrl.Result{}, err
+			}
+			now := time.Now()
+			for _, image := range podImages(reqPod) {
+				GateRemovalHistories.Store(image, now)
+			}
+			metrics.ForcedReleases.Inc()
+			r.Recorder.Eventf(reqPod, corev1.EventTypeWarning, eventReasonGateHoldTimeout, "removed the scheduling gate because the pod has been gated for more than %s", maxGateHold)
+			return ctrl.Result{}, nil
 		}
-		reqImageList = append(reqImageList, initContainer.Image)
 	}
-	for _, container := range reqPod.Spec.Containers {
-		if container.Image == "" {
+
+	reqImages := podImages(reqPod)
+
+	// prevents removing the scheduling gate based on information before the cache is updated.
+	// pods with different images hashes may share images, so the history is recorded per image.
+	for _, image := range reqImages {
+		value, ok := GateRemovalHistories.Load(image)
+		if !ok {
 			continue
 		}
-		reqImageList = append(reqImageList, container.Image)
+		lastGateRemovalTime := value.(time.Time)
+		if time.Since(lastGateRemovalTime) < gateRemovalDelay {
+			logger.V(constants.LevelDebug).Info("perform retry processing to avoid race conditions", "image", image, "lastGateRemovalTime", lastGateRemovalTime)
+			return ctrl.Result{RequeueAfter: gateRemovalDelay}, nil
+		}
 	}
 
-	nodes := &corev1.NodeList{}
-	err = r.List(ctx, nodes)
+	nodes, err := r.snapshotNodes(ctx, reqPod, reqImages, cfg)
 	if err != nil {
 		logger.Error(err, "failed to list nodes")
 		return ctrl.Result{}, err
 	}
 
-	nodeImageSet := make(map[string][]string)
-	for _, node := range nodes.Items {
-		for _, image := range node.Status.Images {
-			nodeImageSet[node.Name] = append(nodeImageSet[node.Name], image.Names...)
+	pods, err := r.snapshotPods(ctx, nodes, cfg.TenantLabel)
+	if err != nil {
+		logger.Error(err, "failed to list pods")
+		return ctrl.Result{}, err
+	}
+	metrics.ReleasedPods.WithLabelValues(metrics.StatePulling).Set(float64(pods.numPulling))
+	metrics.ReleasedPods.WithLabelValues(metrics.StateUnschedulable).Set(float64(pods.numUnschedulable))
+	metrics.ReleasedPods.WithLabelValues(metrics.StateWaiting).Set(float64(pods.numWaiting))
+	metrics.BytesInFlight.Set(float64(pods.bytesInFlight))
+
+	// slow down the pulls from the registries that limit the rate, regardless of the images hash.
+	now := time.Now()
+	var backoff time.Duration
+	for _, host := range imageHosts(reqImages) {
+		registryBackoff := loadRegistryBackoff(host)
+		window := registryBackoff.observe(now, pods.rateLimitedHosts[host], time.Duration(cfg.RegistryBackoffSeconds)*time.Second, time.Duration(cfg.RegistryBackoffMaxSeconds)*time.Second)
+		if window > 0 {
+			logger.Info("back off from the registry limiting the rate of pulls", "registry", host, "window", window)
+		}
+		if remaining := registryBackoff.remaining(now); remaining > backoff {
+			backoff = remaining
 		}
 	}
+	if backoff > 0 {
+		logger.V(constants.LevelDebug).Info("scheduling gates are held because of registry rate limiting", "remaining", backoff)
+		return ctrl.Result{RequeueAfter: backoff}, nil
+	}
 
-	nodeSet := make(map[string]struct{})
-	for nodeName, images := range nodeImageSet {
-		allImageExists := true
-		for _, reqImage := range reqImageList {
-			if !slices.Contains(images, reqImage) {
-				allImageExists = false
-				break
-			}
-		}
-		if allImageExists {
-			nodeSet[nodeName] = struct{}{}
+	// stop releasing the pods whose images keep failing to be pulled, e.g. because of a wrong tag.
+	hash := reqPod.Annotations[constants.CatGateImagesHashAnnotation]
+	var failing []types.UID
+	for _, pod := range pods.pods {
+		if pod.Annotations[constants.CatGateImagesHashAnnotation] == hash && pullFailing(&pod) {
+			failing = append(failing, pod.UID)
 		}
 	}
+	breaker := loadCircuitBreaker(hash)
+	probePod, probeStartedAt := breaker.Probe()
+	probe, err := r.probeResult(ctx, probePod, now.Sub(probeStartedAt) >= time.Duration(cfg.PullFailureProbeSeconds)*time.Second, pods.pods)
+	if err != nil {
+		logger.Error(err, "failed to get probe pod")
+		return ctrl.Result{}, err
+	}
+	opened, closed := breaker.observe(now, failing, probe, int(cfg.PullFailureThreshold))
+	if opened {
+		logger.Info("stop removing scheduling gates because of image pull failures", "numFailures", len(failing))
+		r.recordCircuitOpen(ctx, reqPod, hash, len(failing))
+	}
+	if closed {
+		logger.Info("resume removing scheduling gates because the images have been pulled")
+		r.recordOwnerEvent(reqPod, corev1.EventTypeNormal, eventReasonPullCircuitClosed, "resumed removing scheduling gates because the images have been pulled")
+	}
+	allowed, isProbe := breaker.allow(now, time.Duration(cfg.PullFailureProbeSeconds)*time.Second)
+	if !allowed {
+		logger.V(constants.LevelDebug).Info("scheduling gates are held because of image pull failures")
+		return ctrl.Result{
+			RequeueAfter: time.Duration(cfg.RequeueSeconds) * time.Second,
+		}, nil
+	}
 
-	pods := &corev1.PodList{}
-	err = r.List(ctx, pods, client.MatchingFields{constants.ImageHashAnnotationField: reqImagesHash})
+	gated, err := r.gatedPods(ctx, hash, cfg.RemoveAfterGates)
 	if err != nil {
 		logger.Error(err, "failed to list pods")
 		return ctrl.Result{}, err
 	}
 
-	numSchedulablePods := 0
-	numImagePulledPods := 0
+	// raise the capacity while the pods with the images wait longer than the target.
+	boost := 0
+	if cfg.TargetWaitSeconds > 0 {
+		oldest := now
+		for _, pod := range gated {
+			if t := gatedAt(&pod); t.Before(oldest) {
+				oldest = t
+			}
+		}
+		boost = loadCapacityBoost(hash).observe(now, now.Sub(oldest), time.Duration(cfg.TargetWaitSeconds)*time.Second, time.Duration(cfg.RequeueSeconds)*time.Second)
+	}
 
-	for _, pod := range pods.Items {
-		if existsSchedulingGate(&pod) {
+	// the pod is limited by the image with the least room for pulls.
+	// the images that all nodes already have are not pulled, so they do not limit the pod.
+	schedulable := true
+	pulls := false
+	room := math.MaxInt
+	var reqBytes int64
+	var pulledImages []string
+	for _, image := range reqImages {
+		if nodes.onAllNodes(image) {
 			continue
 		}
-		numSchedulablePods += 1
+		pulls = true
+		pulledImages = append(pulledImages, image)
+		reqBytes += nodes.imageSize(image)
+
+		capacity := nodes.numNodesWithImage[image] * int(cfg.ScaleRate)
+		if capacity < int(cfg.MinimumCapacity) {
+			capacity = int(cfg.MinimumCapacity)
+		}
+		capacity += boost * int(cfg.ScaleRate)
+		logger.V(constants.LevelDebug).Info("scheduling progress", "image", image, "capacity", capacity, "numNodesWithImage", nodes.numNodesWithImage[image], "numImagePullingPods", pods.numImagePullingPods[image], "numUnschedulablePods", pods.numUnschedulablePods[image], "boost", boost)
+
+		if capacity <= pods.numImagePullingPods[image] {
+			schedulable = false
+			break
+		}
+		room = min(room, capacity-pods.numImagePullingPods[image])
+	}
+
+	// the pulls of the namespace are limited by CatGateQuota.
+	var quotasReached map[string]*catgatev1alpha1.CatGateQuota
+	if schedulable && pulls {
+		quotasReached, err = r.quotasReached(ctx, pods.numPullingPodsInNamespace)
+		if err != nil {
+			logger.Error(err, "failed to list quotas")
+			return ctrl.Result{}, err
+		}
+		if quota, ok := quotasReached[reqPod.Namespace]; ok {
+			logger.V(constants.LevelDebug).Info("the number of pulls in the namespace reached the quota", "quota", quota.Name, "numPulling", pods.numPullingPodsInNamespace[reqPod.Namespace], "maxInFlightPulls", quota.Spec.MaxInFlightPulls)
+			schedulable = false
+		}
+	}
 
-		if pod.Status.Phase != corev1.PodPending {
-			numImagePulledPods += 1
+	// the gated pods with the images hash are released in the order of priority and creation,
+	// regardless of the order of reconciliation.
+	// the pods are ordered within each tenant because the tenants share the pulls by their weights,
+	// so the earlier pods of a tenant do not hold the pods of the other tenants with the same images.
+	// the pods of the namespaces that reached their quotas cannot be released, so they do not hold the others either.
+	tenant := tenantOf(reqPod, cfg.TenantLabel)
+	if schedulable && pulls {
+		queue := slices.DeleteFunc(slices.Clone(gated), func(pod corev1.Pod) bool {
+			_, blocked := quotasReached[pod.Namespace]
+			return tenantOf(&pod, cfg.TenantLabel) != tenant || blocked
+		})
+		rank := slices.IndexFunc(queue, func(pod corev1.Pod) bool {
+			return pod.UID == reqPod.UID
+		})
+		if rank >= room {
+			logger.V(constants.LevelDebug).Info("wait for the pods ahead in the queue", "rank", rank, "room", room)
+			schedulable = false
 		}
 	}
 
-	capacity := len(nodeSet) * scaleRate
+	// the pulls across the cluster are limited to protect the shared network and storage.
+	// the limit is shared among the tenants in proportion to their weights,
+	// so that a tenant creating many pods at once does not take all of it.
+	metrics.MaxInFlightPulls.Set(float64(cfg.MaxInFlightPulls))
+	weight := 0
+	if schedulable && pulls && (cfg.MaxInFlightPulls > 0 || len(cfg.RegistryLimits) > 0) {
+		weight, err = r.tenantWeight(ctx, cfg, reqPod, tenant)
+		if err != nil {
+			logger.Error(err, "failed to get namespace")
+			return ctrl.Result{}, err
+		}
+	}
+	if schedulable && pulls && cfg.MaxInFlightPulls > 0 {
+		loadTenantDemand(clusterPool, tenant).observe(now, weight, time.Duration(cfg.RequeueSeconds)*time.Second)
+		shares := fairShares(now, clusterPool, int(cfg.MaxInFlightPulls), pods.numPullingPodsOfTenant)
+		switch {
+		case pods.numPulling >= int(cfg.MaxInFlightPulls):
+			logger.V(constants.LevelDebug).Info("the number of pulls across the cluster reached the limit", "numPulling", pods.numPulling, "maxInFlightPulls", cfg.MaxInFlightPulls)
+			schedulable = false
+		case pods.numPullingPodsOfTenant[tenant] >= shares[tenant] && othersUnderShare(shares, pods.numPullingPodsOfTenant, tenant):
+			logger.V(constants.LevelDebug).Info("the tenant reached its share of the pulls across the cluster", "tenant", tenant, "numPulling", pods.numPullingPodsOfTenant[tenant], "share", shares[tenant])
+			schedulable = false
+		}
+	}
 
-	if capacity < minimumCapacity {
-		capacity = minimumCapacity
+	// large images take a larger share of the budget, so they ramp up slower than small images.
+	// a pod is released when nothing is being pulled, so that an image larger than the budget can be pulled.
+	if schedulable && pulls && cfg.MaxBytesInFlight != nil && pods.bytesInFlight > 0 && pods.bytesInFlight+reqBytes > cfg.MaxBytesInFlight.Value() {
+		logger.V(constants.LevelDebug).Info("the size of the images being pulled reached the limit", "bytesInFlight", pods.bytesInFlight, "requestedBytes", reqBytes, "maxBytesInFlight", cfg.MaxBytesInFlight.Value())
+		schedulable = false
 	}
-	logger.V(constants.LevelDebug).Info("schedule capacity", "capacity", capacity, "len(nodeSet)", len(nodeSet))
 
-	numImagePullingPods := numSchedulablePods - numImagePulledPods
-	logger.V(constants.LevelDebug).Info("scheduling progress", "numSchedulablePods", numSchedulablePods, "numImagePulledPods", numImagePulledPods, "numImagePullingPods", numImagePullingPods)
+	// avoid piling pulls onto the same node, which is slow with serialized image pulls or small disks.
+	if schedulable && pulls && cfg.MaxPullsPerNode > 0 && len(nodes.nodes) > 0 {
+		available := false
+		for _, node := range nodes.nodes {
+			if pods.numPullingPodsOnNode[node.Name] < int(cfg.MaxPullsPerNode) || (len(nodes.alwaysPulled) == 0 && hasAllImages(nodes.imageSets[node.Name], reqImages)) {
+				available = true
+				break
+			}
+		}
+		if !available {
+			logger.V(constants.LevelDebug).Info("all nodes reached the limit of pulls", "maxPullsPerNode", cfg.MaxPullsPerNode)
+			schedulable = false
+		}
+	}
 
-	if capacity > numImagePullingPods {
+	// the limited registries are protected from many images hashes rolling out at once.
+	// only the registries of the images actually pulled are limited.
+	// the pulls and the tokens of each registry are shared among the tenants in the same way as the limit across the cluster.
+	pulledHosts := imageHosts(pulledImages)
+	if schedulable && pulls {
+		for _, limit := range cfg.RegistryLimits {
+			if !slices.Contains(pulledHosts, limit.Host) {
+				continue
+			}
+			loadTenantDemand(limit.Host, tenant).observe(now, weight, time.Duration(cfg.RequeueSeconds)*time.Second)
+			numPulling := pods.numPullingPodsOfHostTenant[limit.Host]
+			shares := fairShares(now, limit.Host, int(limit.MaxConcurrentPulls), numPulling)
+			switch {
+			case pods.numPullingPodsOfHost[limit.Host] >= int(limit.MaxConcurrentPulls):
+				logger.V(constants.LevelDebug).Info("the number of pulls from the registry reached the limit", "registry", limit.Host, "numPulling", pods.numPullingPodsOfHost[limit.Host], "maxConcurrentPulls", limit.MaxConcurrentPulls)
+				schedulable = false
+			case numPulling[tenant] >= shares[tenant] && othersUnderShare(shares, numPulling, tenant):
+				logger.V(constants.LevelDebug).Info("the tenant reached its share of the pulls from the registry", "registry", limit.Host, "tenant", tenant, "numPulling", numPulling[tenant], "share", shares[tenant])
+				schedulable = false
+			}
+			if !schedulable {
+				break
+			}
+		}
+	}
+	if schedulable && pulls {
+		wait := registryTokenWait(now, pulledHosts, cfg.RegistryLimits, tenant)
+		if wait > 0 {
+			logger.V(constants.LevelDebug).Info("scheduling gates are held to wait for registry tokens", "wait", wait)
+			return ctrl.Result{RequeueAfter: wait}, nil
+		}
+	}
+
+	if schedulable {
 		err := r.removeSchedulingGate(ctx, reqPod)
 		if err != nil {
 			logger.Error(err, "failed to remove scheduling gate")
 			return ctrl.Result{}, err
 		}
-		now := time.Now()
-		GateRemovalHistories.Store(reqImagesHash, now)
+		// the tokens are taken only after the removal succeeds, so that a failed update does not waste them.
+		takeRegistryTokens(now, pulledHosts, cfg.RegistryLimits, tenant)
+		now = time.Now()
+		for _, image := range reqImages {
+			GateRemovalHistories.Store(image, now)
+		}
+		if isProbe {
+			logger.Info("released the pod to probe image pulls")
+			breaker.startProbe(now, client.ObjectKeyFromObject(reqPod))
+		}
 		return ctrl.Result{}, nil
 	}
 
 	return ctrl.Result{
-		RequeueAfter: time.Duration(requeueSeconds) * time.Second,
+		RequeueAfter: time.Duration(cfg.RequeueSeconds) * time.Second,
 	}, nil
 }
 
+// probeResult returns the outcome of the probe pod of the circuit breaker.
+// expired is true if the probe was released longer than the probe interval ago.
+// pending is the list of the released pods that are still pending.
+func (r *PodReconciler) probeResult(ctx context.Context, probe types.NamespacedName, expired bool, pending []corev1.Pod) (probeResult, error) {
+	if probe == (types.NamespacedName{}) {
+		return probePulling, nil
+	}
+	for _, pod := range pending {
+		if pod.Namespace != probe.Namespace || pod.Name != probe.Name {
+			continue
+		}
+		if pullFailing(&pod) {
+			return probeFailed, nil
+		}
+		// the probe that does not reach a node tells nothing about the images, so another pod is released as the probe.
+		if isUnschedulable(&pod) || len(pod.Spec.SchedulingGates) > 0 || (pod.Spec.NodeName == "" && expired) {
+			return probeGone, nil
+		}
+		if len(pullingImages(&pod)) == 0 {
+			return probeSucceeded, nil
+		}
+		return probePulling, nil
+	}
+
+	pod := &corev1.Pod{}
+	err := r.Get(ctx, probe, pod)
+	if errors.IsNotFound(err) {
+		return probeGone, nil
+	}
+	if err != nil {
+		return probePulling, err
+	}
+	// the cache may not reflect the removal of the scheduling gate yet.
+	if existsSchedulingGate(pod) || pod.Status.Phase == corev1.PodPending {
+		return probePulling, nil
+	}
+	return probeSucceeded, nil
+}
+
+// quotasReached returns the CatGateQuota reached by the pulls for each namespace.
+func (r *PodReconciler) quotasReached(ctx context.Context, numPullingPodsInNamespace map[string]int) (map[string]*catgatev1alpha1.CatGateQuota, error) {
+	quotas := &catgatev1alpha1.CatGateQuotaList{}
+	err := r.List(ctx, quotas)
+	if err != nil {
+		return nil, err
+	}
+
+	reached := make(map[string]*catgatev1alpha1.CatGateQuota)
+	for i, quota := range quotas.Items {
+		if numPullingPodsInNamespace[quota.Namespace] >= int(quota.Spec.MaxInFlightPulls) {
+			reached[quota.Namespace] = &quotas.Items[i]
+		}
+	}
+	return reached, nil
+}
+
+// gatedPods returns the gated pods with the images hash in the order of release.
+// The pods waiting for the removal of the other scheduling gates are not included.
+func (r *PodReconciler) gatedPods(ctx context.Context, hash string, removeAfterGates []string) ([]corev1.Pod, error) {
+	pods := &corev1.PodList{}
+	err := r.List(ctx, pods, client.MatchingFields{constants.ImageHashAnnotationField: hash})
+	if err != nil {
+		return nil, err
+	}
+
+	var gated []corev1.Pod
+	for _, pod := range pods.Items {
+		if !existsSchedulingGate(&pod) {
+			continue
+		}
+		// the terminating pods are never released, e.g. when they are held by finalizers,
+		// so they must not hold the other pods behind them.
+		if pod.DeletionTimestamp != nil {
+			continue
+		}
+		if _, ok := awaitedGate(&pod, removeAfterGates); ok {
+			continue
+		}
+		gated = append(gated, pod)
+	}
+	sort.Slice(gated, func(i, j int) bool {
+		return releasedBefore(&gated[i], &gated[j])
+	})
+	return gated, nil
+}
+
+// recordCircuitOpen emits events on the gated pods with the images hash and on the owner of the pod.
+func (r *PodReconciler) recordCircuitOpen(ctx context.Context, reqPod *corev1.Pod, hash string, numFailures int) {
+	logger := log.FromContext(ctx)
+	message := fmt.Sprintf("stopped removing scheduling gates because %d pods failed to pull images", numFailures)
+
+	pods := &corev1.PodList{}
+	err := r.List(ctx, pods, client.MatchingFields{constants.ImageHashAnnotationField: hash})
+	if err != nil {
+		logger.Error(err, "failed to list pods")
+	}
+	for _, pod := range pods.Items {
+		if existsSchedulingGate(&pod) {
+			r.Recorder.Event(&pod, corev1.EventTypeWarning, eventReasonPullCircuitOpen, message)
+		}
+	}
+	r.recordOwnerEvent(reqPod, corev1.EventTypeWarning, eventReasonPullCircuitOpen, message)
+}
+
+// recordOwnerEvent emits an event on the controller of the pod such as ReplicaSet and Job.
+func (r *PodReconciler) recordOwnerEvent(pod *corev1.Pod, eventType, reason, message string) {
+	ref := metav1.GetControllerOf(pod)
+	if ref == nil {
+		return
+	}
+	owner := &metav1.PartialObjectMetadata{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: ref.APIVersion,
+			Kind:       ref.Kind,
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: pod.Namespace,
+			Name:      ref.Name,
+			UID:       ref.UID,
+		},
+	}
+	r.Recorder.Event(owner, eventType, reason, message)
+}
+
+// markAwaitingGates records that the pod waits for the scheduling gates of the other controllers.
+func (r *PodReconciler) markAwaitingGates(ctx context.Context, pod *corev1.Pod) error {
+	patch := client.MergeFrom(pod.DeepCopy())
+	pod.Annotations[constants.CatGateAwaitingGatesAnnotation] = "true"
+	return r.Patch(ctx, pod, patch)
+}
+
+// restartGatedAt records the time when the scheduling gates of the other controllers were removed as the time
+// when the pod was gated, so that the time waiting for them does not count as the time held by cat-gate.
+func (r *PodReconciler) restartGatedAt(ctx context.Context, pod *corev1.Pod, now time.Time) error {
+	patch := client.MergeFrom(pod.DeepCopy())
+	pod.Annotations[constants.CatGateGatedAtAnnotation] = now.UTC().Format(time.RFC3339)
+	delete(pod.Annotations, constants.CatGateAwaitingGatesAnnotation)
+	err := r.Patch(ctx, pod, patch)
+	if err != nil {
+		return err
+	}
+	log.FromContext(ctx).V(constants.LevelDebug).Info("the other scheduling gates were removed")
+	return nil
+}
+
 func (r *PodReconciler) removeSchedulingGate(ctx context.Context, pod *corev1.Pod) error {
 	var filteredGates []corev1.PodSchedulingGate
 	existsGate := false
@@ -204,6 +607,125 @@ func (r *PodReconciler) removeSchedulingGate(ctx context.Context, pod *corev1.Po
 	return nil
 }
 
+// podImages returns the normalized images of the containers in the pod without duplicates.
+// The images of the containers with the Never pull policy are not pulled, so they are excluded.
+func podImages(pod *corev1.Pod) []string {
+	var images []string
+	for _, initContainer := range pod.Spec.InitContainers {
+		image := imageref.Normalize(initContainer.Image)
+		if image == "" || !pullsImage(initContainer) || slices.Contains(images, image) {
+			continue
+		}
+		images = append(images, image)
+	}
+	for _, container := range pod.Spec.Containers {
+		image := imageref.Normalize(container.Image)
+		if image == "" || !pullsImage(container) || slices.Contains(images, image) {
+			continue
+		}
+		images = append(images, image)
+	}
+	return images
+}
+
+// hasAllImages returns true if the node has all the images, i.e. the pod pulls nothing on the node.
+func hasAllImages(nodeImageSet imageref.Set, images []string) bool {
+	for _, image := range images {
+		if !nodeImageSet.Has(image) {
+			return false
+		}
+	}
+	return true
+}
+
+// awaitedGate returns the scheduling gate of the pod that must be removed before the gate of cat-gate.
+func awaitedGate(pod *corev1.Pod, removeAfterGates []string) (string, bool) {
+	for _, gate := range pod.Spec.SchedulingGates {
+		if slices.Contains(removeAfterGates, gate.Name) {
+			return gate.Name, true
+		}
+	}
+	return "", false
+}
+
+// releasedBefore returns true if pod a should be released before pod b.
+// The pods are ordered by their priority, then by their creation time.
+func releasedBefore(a, b *corev1.Pod) bool {
+	pa, pb := podPriority(a), podPriority(b)
+	if pa != pb {
+		return pa > pb
+	}
+	if !a.CreationTimestamp.Equal(&b.CreationTimestamp) {
+		return a.CreationTimestamp.Before(&b.CreationTimestamp)
+	}
+	// the creation time has a precision of seconds.
+	if a.Namespace != b.Namespace {
+		return a.Namespace < b.Namespace
+	}
+	return a.Name < b.Name
+}
+
+// the names of the priority classes that Kubernetes creates for the critical system components.
+const (
+	systemClusterCritical = "system-cluster-critical"
+	systemNodeCritical    = "system-node-critical"
+)
+
+// isCritical returns true if the pod must be released regardless of the capacity.
+func isCritical(pod *corev1.Pod, criticalPriority int32) bool {
+	switch pod.Spec.PriorityClassName {
+	case systemClusterCritical, systemNodeCritical:
+		return true
+	}
+	return podPriority(pod) >= criticalPriority
+}
+
+func podPriority(pod *corev1.Pod) int32 {
+	if pod.Spec.Priority == nil {
+		return 0
+	}
+	return *pod.Spec.Priority
+}
+
+// gatedAt returns the time when the pod was admitted by the webhook,
+// or when the scheduling gates of the other controllers were removed if the pod waited for them.
+// It falls back to the creation time for the pods admitted by an older webhook.
+func gatedAt(pod *corev1.Pod) time.Time {
+	if value, ok := pod.Annotations[constants.CatGateGatedAtAnnotation]; ok {
+		t, err := time.Parse(time.RFC3339, value)
+		if err == nil {
+			return t
+		}
+	}
+	return pod.CreationTimestamp.Time
+}
+
+// imageHosts returns the registry hosts of the images without duplicates.
+func imageHosts(images []string) []string {
+	var hosts []string
+	for _, image := range images {
+		host := imageref.Parse(image).Domain
+		if !slices.Contains(hosts, host) {
+			hosts = append(hosts, host)
+		}
+	}
+	return hosts
+}
+
+// isUnschedulable returns true if the scheduler has tried to place the pod and found no node for it.
+// The pods that have not been tried yet are about to pull images, so they are not unschedulable.
+func isUnschedulable(pod *corev1.Pod) bool {
+	if pod.Spec.NodeName != "" {
+		return false
+	}
+	for _, cond := range pod.Status.Conditions {
+		if cond.Type == corev1.PodScheduled {
+			return cond.Status == corev1.ConditionFalse && cond.Reason == corev1.PodReasonUnschedulable
+		}
+	}
+	return false
+}
+
 func existsSchedulingGate(pod *corev1.Pod) bool {
 	for _, gate := range pod.Spec.SchedulingGates {
 		if gate.Name == constants.PodSchedulingGateName {
@@ -224,11 +746,34 @@ func (r *PodReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	}
 
 	return ctrl.NewControllerManagedBy(mgr).
-		For(&corev1.Pod{}).
-		WithEventFilter(predicate.Funcs{
+		For(&corev1.Pod{}, builder.WithPredicates(predicate.Funcs{
 			CreateFunc: func(e event.CreateEvent) bool { return pred(e.Object) },
 			UpdateFunc: func(e event.UpdateEvent) bool { return pred(e.ObjectNew) },
 			DeleteFunc: func(e event.DeleteEvent) bool { return pred(e.Object) },
-		}).
+		})).
+		// re-evaluate the gated pods so that the new parameters take effect without waiting for the requeue.
+		// the updates of the status do not change the parameters, so they are ignored.
+		Watches(&catgatev1alpha1.CatGateConfig{}, handler.EnqueueRequestsFromMapFunc(r.gatedPodRequests),
+			builder.WithPredicates(predicate.GenerationChangedPredicate{})).
 		Complete(r)
 }
+
+func (r *PodReconciler) gatedPodRequests(ctx context.Context, _ client.Object) []reconcile.Request {
+	logger := log.FromContext(ctx)
+
+	pods := &corev1.PodList{}
+	err := r.List(ctx, pods)
+	if err != nil {
+		logger.Error(err, "failed to list pods")
+		return nil
+	}
+
+	var requests []reconcile.Request
+	for _, pod := range pods.Items {
+		if !existsSchedulingGate(&pod) {
+			continue
+		}
+		requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&pod)})
+	}
+	return requests
+}
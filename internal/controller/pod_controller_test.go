@@ -4,12 +4,18 @@ import (
 	"context"
 	"fmt"
 	"regexp"
+	"slices"
 	"strings"
+	"time"
 
+	catgatev1alpha1 "github.com/cybozu-go/cat-gate/api/v1alpha1"
 	"github.com/cybozu-go/cat-gate/internal/constants"
+	"github.com/cybozu-go/cat-gate/internal/imageref"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 	corev1 "k8s.io/api/core/v1"
+	schedulingv1 "k8s.io/api/scheduling/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
@@ -17,7 +23,6 @@ import (
 var _ = Describe("CatGate controller", func() {
 
 	ctx := context.Background()
-	requeueSeconds = 1
 
 	It("should schedule a pod if it is created solely", func() {
 		testName := "single-pod"
@@ -366,9 +371,2413 @@ var _ = Describe("CatGate controller", func() {
 			g.Expect(numSchedulable).To(Equal(20))
 		}).Should(Succeed())
 	})
+
+	It("should count nodes for each image", func() {
+		testName := "partial-images-in-node"
+		namespace := &corev1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: testName,
+			},
+		}
+		err := k8sClient.Create(ctx, namespace)
+		Expect(err).NotTo(HaveOccurred())
+
+		for i := 0; i < 4; i++ {
+			createNewNode(testName, i)
+		}
+		for i := 0; i < 4; i++ {
+			node := &corev1.Node{}
+			err = k8sClient.Get(ctx, client.ObjectKey{Name: fmt.Sprintf("%s-node-%d", testName, i)}, node)
+			Expect(err).NotTo(HaveOccurred())
+			// node-0 and node-1 have only the init container image, node-2 and node-3 have only the container image
+			image := fmt.Sprintf("%s.example.com/sample1-image:1.0.0", testName)
+			if i >= 2 {
+				image = fmt.Sprintf("%s.example.com/sample2-image:1.0.0", testName)
+			}
+			updateNodeImageStatus(node, []corev1.Container{{Image: image}})
+		}
+
+		for i := 0; i < 10; i++ {
+			createNewPod(testName, i)
+		}
+
+		pods := &corev1.PodList{}
+		Eventually(func(g Gomega) {
+			err := k8sClient.List(ctx, pods, &client.ListOptions{Namespace: testName})
+			g.Expect(err).NotTo(HaveOccurred())
+			numSchedulable := 0
+			for _, pod := range pods.Items {
+				if !existsSchedulingGate(&pod) {
+					numSchedulable += 1
+				}
+			}
+			// each image exists on 2 nodes, so 4 (2*2) pods should be scheduled
+			g.Expect(numSchedulable).To(Equal(4))
+		}).Should(Succeed())
+	})
+
+	It("should match images in the canonical form", func() {
+		testName := "normalized-images"
+		namespace := &corev1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: testName,
+			},
+		}
+		err := k8sClient.Create(ctx, namespace)
+		Expect(err).NotTo(HaveOccurred())
+
+		digest := "sha256:6ed4ac8e6e1c5e4dc2e1fc6a8bca5a1a8b1b3c3e0d1d9b1b1a0e1f1e1d1c1b1a"
+		for i := 0; i < 2; i++ {
+			createNewNode(testName, i)
+			node := &corev1.Node{}
+			err = k8sClient.Get(ctx, client.ObjectKey{Name: fmt.Sprintf("%s-node-%d", testName, i)}, node)
+			Expect(err).NotTo(HaveOccurred())
+			// nodes report the fully qualified names
+			node.Status.Images = append(node.Status.Images,
+				corev1.ContainerImage{Names: []string{fmt.Sprintf("docker.io/%s/sample1-image:1.0.0", testName)}},
+				corev1.ContainerImage{Names: []string{
+					fmt.Sprintf("docker.io/%s/sample2-image@%s", testName, digest),
+					fmt.Sprintf("docker.io/%s/sample2-image:1.0.0", testName),
+				}},
+			)
+			err = k8sClient.Status().Update(ctx, node)
+			Expect(err).NotTo(HaveOccurred())
+		}
+
+		for i := 0; i < 10; i++ {
+			createNewPod(testName, i, func(pod *corev1.Pod) {
+				pod.Spec.InitContainers[0].Image = testName + "/sample1-image:1.0.0"
+				pod.Spec.Containers[0].Image = testName + "/sample2-image@" + digest
+			})
+		}
+
+		pods := &corev1.PodList{}
+		Eventually(func(g Gomega) {
+			err := k8sClient.List(ctx, pods, &client.ListOptions{Namespace: testName})
+			g.Expect(err).NotTo(HaveOccurred())
+			numSchedulable := 0
+			for _, pod := range pods.Items {
+				if !existsSchedulingGate(&pod) {
+					numSchedulable += 1
+				}
+			}
+			// the images exist on 2 nodes, so 4 (2*2) pods should be scheduled
+			g.Expect(numSchedulable).To(Equal(4))
+		}).Should(Succeed())
+	})
+
+	It("should count pulls of the same image across images hashes", func() {
+		testName := "shared-image"
+		namespace := &corev1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: testName,
+			},
+		}
+		err := k8sClient.Create(ctx, namespace)
+		Expect(err).NotTo(HaveOccurred())
+
+		createNewPod(testName, 0)
+		pod := &corev1.Pod{}
+		Eventually(func(g Gomega) {
+			err = k8sClient.Get(ctx, client.ObjectKey{Name: fmt.Sprintf("%s-pod-%d", testName, 0), Namespace: testName}, pod)
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(existsSchedulingGate(pod)).To(BeFalse())
+		}).Should(Succeed())
+
+		// the pod has the same init container image as the pulling pod but a different images hash
+		createNewPod(testName, 1, func(pod *corev1.Pod) {
+			pod.Spec.Containers[0].Image = testName + ".example.com/sample3-image:1.0.0"
+		})
+		Consistently(func(g Gomega) {
+			err = k8sClient.Get(ctx, client.ObjectKey{Name: fmt.Sprintf("%s-pod-%d", testName, 1), Namespace: testName}, pod)
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(existsSchedulingGate(pod)).To(BeTrue())
+		}, "3s").Should(Succeed())
+	})
+
+	It("should not count the nodes on which the pod cannot be placed", func() {
+		testName := "tainted-nodes"
+		namespace := &corev1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: testName,
+			},
+		}
+		err := k8sClient.Create(ctx, namespace)
+		Expect(err).NotTo(HaveOccurred())
+
+		for i := 0; i < 4; i++ {
+			createNewNode(testName, i)
+			node := &corev1.Node{}
+			err = k8sClient.Get(ctx, client.ObjectKey{Name: fmt.Sprintf("%s-node-%d", testName, i)}, node)
+			Expect(err).NotTo(HaveOccurred())
+			// node-2 and node-3 have a taint that the pods do not tolerate
+			if i >= 2 {
+				node.Spec.Taints = []corev1.Taint{{Key: testName, Effect: corev1.TaintEffectNoSchedule}}
+				err = k8sClient.Update(ctx, node)
+				Expect(err).NotTo(HaveOccurred())
+			}
+			updateNodeImageStatus(node, []corev1.Container{
+				{Image: fmt.Sprintf("%s.example.com/sample1-image:1.0.0", testName)},
+				{Image: fmt.Sprintf("%s.example.com/sample2-image:1.0.0", testName)},
+			})
+		}
+
+		for i := 0; i < 10; i++ {
+			createNewPod(testName, i)
+		}
+
+		pods := &corev1.PodList{}
+		Eventually(func(g Gomega) {
+			err := k8sClient.List(ctx, pods, &client.ListOptions{Namespace: testName})
+			g.Expect(err).NotTo(HaveOccurred())
+			numSchedulable := 0
+			for _, pod := range pods.Items {
+				if !existsSchedulingGate(&pod) {
+					numSchedulable += 1
+				}
+			}
+			// the images exist on 2 nodes without the taint, so 4 (2*2) pods should be scheduled
+			g.Expect(numSchedulable).To(Equal(4))
+		}).Should(Succeed())
+	})
+
+	It("should not count the nodes that are cordoned or not ready", func() {
+		testName := "unusable-nodes"
+		namespace := &corev1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: testName,
+			},
+		}
+		err := k8sClient.Create(ctx, namespace)
+		Expect(err).NotTo(HaveOccurred())
+
+		for i := 0; i < 4; i++ {
+			createNewNode(testName, i)
+			node := &corev1.Node{}
+			err = k8sClient.Get(ctx, client.ObjectKey{Name: fmt.Sprintf("%s-node-%d", testName, i)}, node)
+			Expect(err).NotTo(HaveOccurred())
+			// node-2 is cordoned and node-3 is not ready
+			switch i {
+			case 2:
+				node.Spec.Unschedulable = true
+				err = k8sClient.Update(ctx, node)
+				Expect(err).NotTo(HaveOccurred())
+			case 3:
+				node.Status.Conditions = []corev1.NodeCondition{{Type: corev1.NodeReady, Status: corev1.ConditionUnknown}}
+			}
+			updateNodeImageStatus(node, []corev1.Container{
+				{Image: fmt.Sprintf("%s.example.com/sample1-image:1.0.0", testName)},
+				{Image: fmt.Sprintf("%s.example.com/sample2-image:1.0.0", testName)},
+			})
+		}
+
+		for i := 0; i < 10; i++ {
+			createNewPod(testName, i)
+		}
+
+		pods := &corev1.PodList{}
+		Eventually(func(g Gomega) {
+			err := k8sClient.List(ctx, pods, &client.ListOptions{Namespace: testName})
+			g.Expect(err).NotTo(HaveOccurred())
+			numSchedulable := 0
+			for _, pod := range pods.Items {
+				if !existsSchedulingGate(&pod) {
+					numSchedulable += 1
+				}
+			}
+			// the images exist on 2 usable nodes, so 4 (2*2) pods should be scheduled
+			g.Expect(numSchedulable).To(Equal(4))
+		}).Should(Succeed())
+	})
+
+	It("should not count the nodes selected by the excluded node selector", func() {
+		testName := "excluded-nodes"
+		namespace := &corev1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: testName,
+			},
+		}
+		err := k8sClient.Create(ctx, namespace)
+		Expect(err).NotTo(HaveOccurred())
+
+		updateConfig(func(spec *catgatev1alpha1.CatGateConfigSpec) {
+			spec.ExcludedNodeSelector = &metav1.LabelSelector{MatchLabels: map[string]string{testName: "true"}}
+		})
+		DeferCleanup(func() {
+			updateConfig(func(spec *catgatev1alpha1.CatGateConfigSpec) {
+				spec.ExcludedNodeSelector = nil
+			})
+		})
+
+		for i := 0; i < 4; i++ {
+			createNewNode(testName, i)
+			node := &corev1.Node{}
+			err = k8sClient.Get(ctx, client.ObjectKey{Name: fmt.Sprintf("%s-node-%d", testName, i)}, node)
+			Expect(err).NotTo(HaveOccurred())
+			// node-2 and node-3 are excluded
+			if i >= 2 {
+				node.Labels = map[string]string{testName: "true"}
+				err = k8sClient.Update(ctx, node)
+				Expect(err).NotTo(HaveOccurred())
+			}
+			updateNodeImageStatus(node, []corev1.Container{
+				{Image: fmt.Sprintf("%s.example.com/sample1-image:1.0.0", testName)},
+				{Image: fmt.Sprintf("%s.example.com/sample2-image:1.0.0", testName)},
+			})
+		}
+
+		for i := 0; i < 10; i++ {
+			createNewPod(testName, i)
+		}
+
+		pods := &corev1.PodList{}
+		Eventually(func(g Gomega) {
+			err := k8sClient.List(ctx, pods, &client.ListOptions{Namespace: testName})
+			g.Expect(err).NotTo(HaveOccurred())
+			numSchedulable := 0
+			for _, pod := range pods.Items {
+				if !existsSchedulingGate(&pod) {
+					numSchedulable += 1
+				}
+			}
+			// the images exist on 2 nodes that are not excluded, so 4 (2*2) pods should be scheduled
+			g.Expect(numSchedulable).To(Equal(4))
+		}).Should(Succeed())
+	})
+
+	It("should not count the pods that cannot be scheduled as pulling", func() {
+		testName := "unschedulable-pods"
+		namespace := &corev1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: testName,
+			},
+		}
+		err := k8sClient.Create(ctx, namespace)
+		Expect(err).NotTo(HaveOccurred())
+
+		for i := 0; i < 8; i++ {
+			createNewPod(testName, i)
+		}
+
+		pods := &corev1.PodList{}
+		Eventually(func(g Gomega) {
+			err := k8sClient.List(ctx, pods, &client.ListOptions{Namespace: testName})
+			g.Expect(err).NotTo(HaveOccurred())
+			numSchedulable := 0
+			for _, pod := range pods.Items {
+				if !existsSchedulingGate(&pod) {
+					numSchedulable += 1
+				}
+			}
+			g.Expect(numSchedulable).To(Equal(1))
+		}).Should(Succeed())
+		markOneUnschedulablePod(testName)
+
+		Eventually(func(g Gomega) {
+			err := k8sClient.List(ctx, pods, &client.ListOptions{Namespace: testName})
+			g.Expect(err).NotTo(HaveOccurred())
+			numSchedulable := 0
+			for _, pod := range pods.Items {
+				if !existsSchedulingGate(&pod) {
+					numSchedulable += 1
+				}
+			}
+			// the unschedulable pod does not pull images, so another pod should be scheduled
+			g.Expect(numSchedulable).To(Equal(2))
+		}).Should(Succeed())
+	})
+
+	It("should not count the pods waiting for other than images as pulling", func() {
+		testName := "waiting-for-volumes"
+		namespace := &corev1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: testName,
+			},
+		}
+		err := k8sClient.Create(ctx, namespace)
+		Expect(err).NotTo(HaveOccurred())
+
+		createNewPod(testName, 0)
+		pod := &corev1.Pod{}
+		Eventually(func(g Gomega) {
+			err = k8sClient.Get(ctx, client.ObjectKey{Name: fmt.Sprintf("%s-pod-%d", testName, 0), Namespace: testName}, pod)
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(existsSchedulingGate(pod)).To(BeFalse())
+		}).Should(Succeed())
+
+		// the sandbox is not created because of a volume mount, so the images are not pulled yet
+		pod.Status.Conditions = []corev1.PodCondition{
+			{Type: corev1.PodReadyToStartContainers, Status: corev1.ConditionFalse},
+		}
+		pod.Status.InitContainerStatuses = []corev1.ContainerStatus{
+			{Name: "sample1", State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "ContainerCreating"}}},
+		}
+		pod.Status.ContainerStatuses = []corev1.ContainerStatus{
+			{Name: "sample2", State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "PodInitializing"}}},
+		}
+		err = k8sClient.Status().Update(ctx, pod)
+		Expect(err).NotTo(HaveOccurred())
+
+		createNewPod(testName, 1)
+		Eventually(func(g Gomega) {
+			err = k8sClient.Get(ctx, client.ObjectKey{Name: fmt.Sprintf("%s-pod-%d", testName, 1), Namespace: testName}, pod)
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(existsSchedulingGate(pod)).To(BeFalse())
+		}).Should(Succeed())
+	})
+
+	It("should count only the images that are not pulled yet", func() {
+		testName := "partially-pulled"
+		namespace := &corev1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: testName,
+			},
+		}
+		err := k8sClient.Create(ctx, namespace)
+		Expect(err).NotTo(HaveOccurred())
+
+		createNewPod(testName, 0)
+		pod := &corev1.Pod{}
+		Eventually(func(g Gomega) {
+			err = k8sClient.Get(ctx, client.ObjectKey{Name: fmt.Sprintf("%s-pod-%d", testName, 0), Namespace: testName}, pod)
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(existsSchedulingGate(pod)).To(BeFalse())
+		}).Should(Succeed())
+
+		// the init container image has been pulled, and the container image is being pulled
+		pod.Status.InitContainerStatuses = []corev1.ContainerStatus{
+			{
+				Name:    "sample1",
+				ImageID: "sha256:0123456789abcdef",
+				State:   corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{Reason: "Completed"}},
+			},
+		}
+		pod.Status.ContainerStatuses = []corev1.ContainerStatus{
+			{Name: "sample2", State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "ContainerCreating"}}},
+		}
+		err = k8sClient.Status().Update(ctx, pod)
+		Expect(err).NotTo(HaveOccurred())
+
+		// the pod shares only the init container image with the pulling pod
+		createNewPod(testName, 1, func(pod *corev1.Pod) {
+			pod.Spec.Containers[0].Image = testName + ".example.com/sample3-image:1.0.0"
+		})
+		Eventually(func(g Gomega) {
+			err = k8sClient.Get(ctx, client.ObjectKey{Name: fmt.Sprintf("%s-pod-%d", testName, 1), Namespace: testName}, pod)
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(existsSchedulingGate(pod)).To(BeFalse())
+		}).Should(Succeed())
+	})
+
+	It("should stop removing scheduling gates when images fail to be pulled", func() {
+		testName := "pull-failures"
+		namespace := &corev1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: testName,
+			},
+		}
+		err := k8sClient.Create(ctx, namespace)
+		Expect(err).NotTo(HaveOccurred())
+
+		minimumCapacity := int32(3)
+		profile := &catgatev1alpha1.CatGateProfile{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: testName,
+				Name:      "wide",
+			},
+			Spec: catgatev1alpha1.CatGateProfileSpec{
+				MinimumCapacity: &minimumCapacity,
+			},
+		}
+		err = k8sClient.Create(ctx, profile)
+		Expect(err).NotTo(HaveOccurred())
+
+		for i := 0; i < 3; i++ {
+			createNewPod(testName, i)
+		}
+
+		pods := &corev1.PodList{}
+		Eventually(func(g Gomega) {
+			err := k8sClient.List(ctx, pods, &client.ListOptions{Namespace: testName})
+			g.Expect(err).NotTo(HaveOccurred())
+			numSchedulable := 0
+			for _, pod := range pods.Items {
+				if !existsSchedulingGate(&pod) {
+					numSchedulable += 1
+				}
+			}
+			g.Expect(numSchedulable).To(Equal(3))
+		}).Should(Succeed())
+
+		// the pod in the other namespace has the same images hash, and it is held behind the released pods.
+		other := testName + "-other"
+		otherNamespace := &corev1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: other,
+			},
+		}
+		err = k8sClient.Create(ctx, otherNamespace)
+		Expect(err).NotTo(HaveOccurred())
+		createNewPod(other, 0, func(pod *corev1.Pod) {
+			pod.Spec.InitContainers[0].Image = testName + ".example.com/sample1-image:1.0.0"
+			pod.Spec.Containers[0].Image = testName + ".example.com/sample2-image:1.0.0"
+		})
+
+		// all the released pods fail to pull the images, which reaches the default threshold
+		for _, pod := range pods.Items {
+			pod.Status.ContainerStatuses = []corev1.ContainerStatus{
+				{Name: "sample2", State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "ImagePullBackOff"}}},
+			}
+			err = k8sClient.Status().Update(ctx, &pod)
+			Expect(err).NotTo(HaveOccurred())
+		}
+
+		// raise the capacity so that only the circuit breaker holds the scheduling gates
+		err = k8sClient.Get(ctx, client.ObjectKeyFromObject(profile), profile)
+		Expect(err).NotTo(HaveOccurred())
+		minimumCapacity = 10
+		profile.Spec.MinimumCapacity = &minimumCapacity
+		err = k8sClient.Update(ctx, profile)
+		Expect(err).NotTo(HaveOccurred())
+
+		for i := 3; i < 6; i++ {
+			createNewPod(testName, i)
+		}
+		Consistently(func(g Gomega) {
+			err := k8sClient.List(ctx, pods, &client.ListOptions{Namespace: testName})
+			g.Expect(err).NotTo(HaveOccurred())
+			numSchedulable := 0
+			for _, pod := range pods.Items {
+				if !existsSchedulingGate(&pod) {
+					numSchedulable += 1
+				}
+			}
+			g.Expect(numSchedulable).To(Equal(3))
+		}, "3s").Should(Succeed())
+
+		events := &corev1.EventList{}
+		Eventually(func(g Gomega) {
+			err := k8sClient.List(ctx, events, &client.ListOptions{Namespace: testName})
+			g.Expect(err).NotTo(HaveOccurred())
+			var reasons []string
+			for _, event := range events.Items {
+				reasons = append(reasons, event.Reason)
+			}
+			g.Expect(reasons).To(ContainElement(eventReasonPullCircuitOpen))
+		}).Should(Succeed())
+		// the circuit breaker is shared by the namespaces, so the gated pods in the other namespace are told as well.
+		Eventually(func(g Gomega) {
+			err := k8sClient.List(ctx, events, &client.ListOptions{Namespace: other})
+			g.Expect(err).NotTo(HaveOccurred())
+			var reasons []string
+			for _, event := range events.Items {
+				reasons = append(reasons, event.Reason)
+			}
+			g.Expect(reasons).To(ContainElement(eventReasonPullCircuitOpen))
+		}).Should(Succeed())
+	})
+
+	It("should release another probe when the probe cannot be scheduled", func() {
+		testName := "unschedulable-probe"
+		namespace := &corev1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: testName,
+			},
+		}
+		err := k8sClient.Create(ctx, namespace)
+		Expect(err).NotTo(HaveOccurred())
+
+		updateConfig(func(spec *catgatev1alpha1.CatGateConfigSpec) {
+			spec.PullFailureProbeSeconds = 3
+		})
+		DeferCleanup(func() {
+			updateConfig(func(spec *catgatev1alpha1.CatGateConfigSpec) {
+				spec.PullFailureProbeSeconds = 0
+			})
+		})
+
+		minimumCapacity := int32(10)
+		profile := &catgatev1alpha1.CatGateProfile{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: testName,
+				Name:      "wide",
+			},
+			Spec: catgatev1alpha1.CatGateProfileSpec{
+				MinimumCapacity: &minimumCapacity,
+			},
+		}
+		err = k8sClient.Create(ctx, profile)
+		Expect(err).NotTo(HaveOccurred())
+
+		for i := 0; i < 3; i++ {
+			createNewPod(testName, i)
+		}
+		pods := &corev1.PodList{}
+		Eventually(func(g Gomega) {
+			err := k8sClient.List(ctx, pods, &client.ListOptions{Namespace: testName})
+			g.Expect(err).NotTo(HaveOccurred())
+			numSchedulable := 0
+			for _, pod := range pods.Items {
+				if !existsSchedulingGate(&pod) {
+					numSchedulable += 1
+				}
+			}
+			g.Expect(numSchedulable).To(Equal(3))
+		}).Should(Succeed())
+
+		// all the released pods fail to pull the images, which opens the breaker
+		failing := make(map[string]bool)
+		for _, pod := range pods.Items {
+			failing[pod.Name] = true
+			pod.Status.ContainerStatuses = []corev1.ContainerStatus{
+				{Name: "sample2", State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "ImagePullBackOff"}}},
+			}
+			err = k8sClient.Status().Update(ctx, &pod)
+			Expect(err).NotTo(HaveOccurred())
+		}
+		for i := 3; i < 6; i++ {
+			createNewPod(testName, i)
+		}
+
+		// a single pod is released as the probe after the probe interval
+		probe := &corev1.Pod{}
+		Eventually(func(g Gomega) {
+			err := k8sClient.List(ctx, pods, &client.ListOptions{Namespace: testName})
+			g.Expect(err).NotTo(HaveOccurred())
+			var released []corev1.Pod
+			for _, pod := range pods.Items {
+				if !existsSchedulingGate(&pod) && !failing[pod.Name] {
+					released = append(released, pod)
+				}
+			}
+			g.Expect(released).To(HaveLen(1))
+			*probe = released[0]
+		}, "10s").Should(Succeed())
+
+		// the probe cannot be placed, so another pod is released as the probe before the probe expires
+		probe.Status.Phase = corev1.PodPending
+		probe.Status.Conditions = []corev1.PodCondition{
+			{
+				Type:   corev1.PodScheduled,
+				Status: corev1.ConditionFalse,
+				Reason: corev1.PodReasonUnschedulable,
+			},
+		}
+		err = k8sClient.Status().Update(ctx, probe)
+		Expect(err).NotTo(HaveOccurred())
+
+		Eventually(func(g Gomega) {
+			err := k8sClient.List(ctx, pods, &client.ListOptions{Namespace: testName})
+			g.Expect(err).NotTo(HaveOccurred())
+			numSchedulable := 0
+			for _, pod := range pods.Items {
+				if !existsSchedulingGate(&pod) {
+					numSchedulable += 1
+				}
+			}
+			g.Expect(numSchedulable).To(Equal(5))
+		}, "2s").Should(Succeed())
+	})
+
+	It("should back off from the registry that limits the rate of pulls", func() {
+		testName := "rate-limited-registry"
+		namespace := &corev1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: testName,
+			},
+		}
+		err := k8sClient.Create(ctx, namespace)
+		Expect(err).NotTo(HaveOccurred())
+
+		createNewPod(testName, 0)
+		pod := &corev1.Pod{}
+		Eventually(func(g Gomega) {
+			err = k8sClient.Get(ctx, client.ObjectKey{Name: fmt.Sprintf("%s-pod-%d", testName, 0), Namespace: testName}, pod)
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(existsSchedulingGate(pod)).To(BeFalse())
+		}).Should(Succeed())
+
+		pod.Status.ContainerStatuses = []corev1.ContainerStatus{
+			{
+				Name: "sample2",
+				State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{
+					Reason:  "ErrImagePull",
+					Message: "failed to pull and unpack image: 429 Too Many Requests - Server message: toomanyrequests: You have reached your pull rate limit.",
+				}},
+			},
+		}
+		err = k8sClient.Status().Update(ctx, pod)
+		Expect(err).NotTo(HaveOccurred())
+
+		// the pod has different images from the same registry
+		createNewPod(testName, 1, func(pod *corev1.Pod) {
+			pod.Spec.InitContainers[0].Image = testName + ".example.com/sample3-image:1.0.0"
+			pod.Spec.Containers[0].Image = testName + ".example.com/sample4-image:1.0.0"
+		})
+		Consistently(func(g Gomega) {
+			err = k8sClient.Get(ctx, client.ObjectKey{Name: fmt.Sprintf("%s-pod-%d", testName, 1), Namespace: testName}, pod)
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(existsSchedulingGate(pod)).To(BeTrue())
+		}, "3s").Should(Succeed())
+	})
+
+	It("should not back off from the registry because of the other pull failures", func() {
+		testName := "not-rate-limited-registry"
+		namespace := &corev1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: testName,
+			},
+		}
+		err := k8sClient.Create(ctx, namespace)
+		Expect(err).NotTo(HaveOccurred())
+
+		createNewPod(testName, 0, func(pod *corev1.Pod) {
+			pod.Spec.Containers[0].Image = testName + ".example.com/sample2-image:1.429"
+		})
+		pod := &corev1.Pod{}
+		Eventually(func(g Gomega) {
+			err = k8sClient.Get(ctx, client.ObjectKey{Name: fmt.Sprintf("%s-pod-%d", testName, 0), Namespace: testName}, pod)
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(existsSchedulingGate(pod)).To(BeFalse())
+		}).Should(Succeed())
+
+		// the tag of the image contains 429, but the registry does not limit the rate of pulls.
+		pod.Status.ContainerStatuses = []corev1.ContainerStatus{
+			{
+				Name: "sample2",
+				State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{
+					Reason:  "ErrImagePull",
+					Message: `failed to pull image "` + testName + `.example.com/sample2-image:1.429": not found`,
+				}},
+			},
+		}
+		err = k8sClient.Status().Update(ctx, pod)
+		Expect(err).NotTo(HaveOccurred())
+
+		// the pod has different images from the same registry
+		createNewPod(testName, 1, func(pod *corev1.Pod) {
+			pod.Spec.InitContainers[0].Image = testName + ".example.com/sample3-image:1.0.0"
+			pod.Spec.Containers[0].Image = testName + ".example.com/sample4-image:1.0.0"
+		})
+		Eventually(func(g Gomega) {
+			err = k8sClient.Get(ctx, client.ObjectKey{Name: fmt.Sprintf("%s-pod-%d", testName, 1), Namespace: testName}, pod)
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(existsSchedulingGate(pod)).To(BeFalse())
+		}).Should(Succeed())
+	})
+
+	It("should limit the removal of scheduling gates for each registry", func() {
+		testName := "registry-limit"
+		namespace := &corev1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: testName,
+			},
+		}
+		err := k8sClient.Create(ctx, namespace)
+		Expect(err).NotTo(HaveOccurred())
+
+		updateConfig(func(spec *catgatev1alpha1.CatGateConfigSpec) {
+			spec.RegistryLimits = []catgatev1alpha1.RegistryLimit{
+				{Host: testName + ".example.com", MaxConcurrentPulls: 2, RefillPerMinute: 1},
+			}
+		})
+		DeferCleanup(func() {
+			updateConfig(func(spec *catgatev1alpha1.CatGateConfigSpec) {
+				spec.RegistryLimits = nil
+			})
+		})
+
+		minimumCapacity := int32(10)
+		profile := &catgatev1alpha1.CatGateProfile{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: testName,
+				Name:      "wide",
+			},
+			Spec: catgatev1alpha1.CatGateProfileSpec{
+				MinimumCapacity: &minimumCapacity,
+			},
+		}
+		err = k8sClient.Create(ctx, profile)
+		Expect(err).NotTo(HaveOccurred())
+
+		// the pods have different images from the same registry
+		for i := 0; i < 5; i++ {
+			createNewPod(testName, i, func(pod *corev1.Pod) {
+				pod.Spec.Containers[0].Image = fmt.Sprintf("%s.example.com/app%d-image:1.0.0", testName, i)
+			})
+		}
+
+		pods := &corev1.PodList{}
+		Eventually(func(g Gomega) {
+			err := k8sClient.List(ctx, pods, &client.ListOptions{Namespace: testName})
+			g.Expect(err).NotTo(HaveOccurred())
+			numSchedulable := 0
+			for _, pod := range pods.Items {
+				if !existsSchedulingGate(&pod) {
+					numSchedulable += 1
+				}
+			}
+			g.Expect(numSchedulable).To(Equal(2))
+		}).Should(Succeed())
+		Consistently(func(g Gomega) {
+			err := k8sClient.List(ctx, pods, &client.ListOptions{Namespace: testName})
+			g.Expect(err).NotTo(HaveOccurred())
+			numSchedulable := 0
+			for _, pod := range pods.Items {
+				if !existsSchedulingGate(&pod) {
+					numSchedulable += 1
+				}
+			}
+			// the bucket has only 2 tokens and is refilled once a minute
+			g.Expect(numSchedulable).To(Equal(2))
+		}, "3s").Should(Succeed())
+	})
+
+	It("should share the pulls from each registry among the tenants", func() {
+		testName := "registry-fair-share"
+		host := testName + ".example.com"
+		tenantA := testName + "-a"
+		tenantB := testName + "-b"
+		for _, name := range []string{tenantA, tenantB} {
+			namespace := &corev1.Namespace{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: name,
+				},
+			}
+			err := k8sClient.Create(ctx, namespace)
+			Expect(err).NotTo(HaveOccurred())
+
+			minimumCapacity := int32(10)
+			profile := &catgatev1alpha1.CatGateProfile{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace: name,
+					Name:      "wide",
+				},
+				Spec: catgatev1alpha1.CatGateProfileSpec{
+					MinimumCapacity: &minimumCapacity,
+				},
+			}
+			err = k8sClient.Create(ctx, profile)
+			Expect(err).NotTo(HaveOccurred())
+		}
+
+		// the bucket is refilled quickly, so only the number of pulls in flight holds the scheduling gates
+		updateConfig(func(spec *catgatev1alpha1.CatGateConfigSpec) {
+			spec.RegistryLimits = []catgatev1alpha1.RegistryLimit{
+				{Host: host, MaxConcurrentPulls: 4, RefillPerMinute: 600},
+			}
+		})
+		DeferCleanup(func() {
+			updateConfig(func(spec *catgatev1alpha1.CatGateConfigSpec) {
+				spec.RegistryLimits = nil
+			})
+		})
+
+		countReleased := func(g Gomega, namespace string) int {
+			pods := &corev1.PodList{}
+			err := k8sClient.List(ctx, pods, &client.ListOptions{Namespace: namespace})
+			g.Expect(err).NotTo(HaveOccurred())
+			numSchedulable := 0
+			for _, pod := range pods.Items {
+				if !existsSchedulingGate(&pod) {
+					numSchedulable += 1
+				}
+			}
+			return numSchedulable
+		}
+		// the pods have different images from the same registry
+		fromRegistry := func(namespace string, i int) func(*corev1.Pod) {
+			return func(pod *corev1.Pod) {
+				pod.Spec.InitContainers[0].Image = fmt.Sprintf("%s/%s-init%d-image:1.0.0", host, namespace, i)
+				pod.Spec.Containers[0].Image = fmt.Sprintf("%s/%s-app%d-image:1.0.0", host, namespace, i)
+			}
+		}
+
+		// tenant A takes all the pulls from the registry while the others do not wait for it.
+		for i := 0; i < 10; i++ {
+			createNewPod(tenantA, i, fromRegistry(tenantA, i))
+		}
+		Eventually(func(g Gomega) {
+			g.Expect(countReleased(g, tenantA)).To(Equal(4))
+		}).Should(Succeed())
+
+		for i := 0; i < 2; i++ {
+			createNewPod(tenantB, i, fromRegistry(tenantB, i))
+		}
+		Consistently(func(g Gomega) {
+			g.Expect(countReleased(g, tenantB)).To(Equal(0))
+		}, "2s").Should(Succeed())
+
+		// 2 pulls of tenant A finish, and they are taken by tenant B, which pulls less than its share.
+		pods := &corev1.PodList{}
+		err := k8sClient.List(ctx, pods, &client.ListOptions{Namespace: tenantA})
+		Expect(err).NotTo(HaveOccurred())
+		finished := 0
+		for _, pod := range pods.Items {
+			if !existsSchedulingGate(&pod) && finished < 2 {
+				updatePodStatus(&pod, corev1.ContainerState{Running: &corev1.ContainerStateRunning{}}, corev1.PodRunning)
+				finished += 1
+			}
+		}
+		Eventually(func(g Gomega) {
+			g.Expect(countReleased(g, tenantB)).To(Equal(2))
+		}).Should(Succeed())
+		Consistently(func(g Gomega) {
+			g.Expect(countReleased(g, tenantA)).To(Equal(4))
+		}, "2s").Should(Succeed())
+	})
+
+	It("should limit the number of pulls in flight from each registry", func() {
+		testName := "registry-concurrency"
+		namespace := &corev1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: testName,
+			},
+		}
+		err := k8sClient.Create(ctx, namespace)
+		Expect(err).NotTo(HaveOccurred())
+
+		// the bucket is refilled quickly, so only the number of pulls in flight holds the scheduling gates
+		updateConfig(func(spec *catgatev1alpha1.CatGateConfigSpec) {
+			spec.RegistryLimits = []catgatev1alpha1.RegistryLimit{
+				{Host: testName + ".example.com", MaxConcurrentPulls: 2, RefillPerMinute: 600},
+			}
+		})
+		DeferCleanup(func() {
+			updateConfig(func(spec *catgatev1alpha1.CatGateConfigSpec) {
+				spec.RegistryLimits = nil
+			})
+		})
+
+		minimumCapacity := int32(10)
+		profile := &catgatev1alpha1.CatGateProfile{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: testName,
+				Name:      "wide",
+			},
+			Spec: catgatev1alpha1.CatGateProfileSpec{
+				MinimumCapacity: &minimumCapacity,
+			},
+		}
+		err = k8sClient.Create(ctx, profile)
+		Expect(err).NotTo(HaveOccurred())
+
+		// the pods have different images from the same registry
+		for i := 0; i < 5; i++ {
+			createNewPod(testName, i, func(pod *corev1.Pod) {
+				pod.Spec.Containers[0].Image = fmt.Sprintf("%s.example.com/app%d-image:1.0.0", testName, i)
+			})
+		}
+
+		pods := &corev1.PodList{}
+		Eventually(func(g Gomega) {
+			err := k8sClient.List(ctx, pods, &client.ListOptions{Namespace: testName})
+			g.Expect(err).NotTo(HaveOccurred())
+			numSchedulable := 0
+			for _, pod := range pods.Items {
+				if !existsSchedulingGate(&pod) {
+					numSchedulable += 1
+				}
+			}
+			g.Expect(numSchedulable).To(Equal(2))
+		}).Should(Succeed())
+		Consistently(func(g Gomega) {
+			err := k8sClient.List(ctx, pods, &client.ListOptions{Namespace: testName})
+			g.Expect(err).NotTo(HaveOccurred())
+			numSchedulable := 0
+			for _, pod := range pods.Items {
+				if !existsSchedulingGate(&pod) {
+					numSchedulable += 1
+				}
+			}
+			g.Expect(numSchedulable).To(Equal(2))
+		}, "3s").Should(Succeed())
+
+		// a pull from the registry finishes, so another pod can pull
+		for _, pod := range pods.Items {
+			if !existsSchedulingGate(&pod) {
+				updatePodStatus(&pod, corev1.ContainerState{Running: &corev1.ContainerStateRunning{}}, corev1.PodRunning)
+				break
+			}
+		}
+		Eventually(func(g Gomega) {
+			err := k8sClient.List(ctx, pods, &client.ListOptions{Namespace: testName})
+			g.Expect(err).NotTo(HaveOccurred())
+			numSchedulable := 0
+			for _, pod := range pods.Items {
+				if !existsSchedulingGate(&pod) {
+					numSchedulable += 1
+				}
+			}
+			g.Expect(numSchedulable).To(Equal(3))
+		}).Should(Succeed())
+	})
+
+	It("should limit the number of pulls across the cluster", func() {
+		testName := "max-in-flight-pulls"
+		namespace := &corev1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: testName,
+			},
+		}
+		err := k8sClient.Create(ctx, namespace)
+		Expect(err).NotTo(HaveOccurred())
+
+		// the pods released in the other tests are still pulling
+		maxInFlightPulls := int32(countInFlightPulls() + 2)
+		updateConfig(func(spec *catgatev1alpha1.CatGateConfigSpec) {
+			spec.MaxInFlightPulls = maxInFlightPulls
+		})
+		DeferCleanup(func() {
+			updateConfig(func(spec *catgatev1alpha1.CatGateConfigSpec) {
+				spec.MaxInFlightPulls = 0
+			})
+		})
+
+		minimumCapacity := int32(10)
+		profile := &catgatev1alpha1.CatGateProfile{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: testName,
+				Name:      "wide",
+			},
+			Spec: catgatev1alpha1.CatGateProfileSpec{
+				MinimumCapacity: &minimumCapacity,
+			},
+		}
+		err = k8sClient.Create(ctx, profile)
+		Expect(err).NotTo(HaveOccurred())
+
+		for i := 0; i < 5; i++ {
+			createNewPod(testName, i, func(pod *corev1.Pod) {
+				pod.Spec.Containers[0].Image = fmt.Sprintf("%s.example.com/app%d-image:1.0.0", testName, i)
+			})
+		}
+
+		pods := &corev1.PodList{}
+		Eventually(func(g Gomega) {
+			err := k8sClient.List(ctx, pods, &client.ListOptions{Namespace: testName})
+			g.Expect(err).NotTo(HaveOccurred())
+			numSchedulable := 0
+			for _, pod := range pods.Items {
+				if !existsSchedulingGate(&pod) {
+					numSchedulable += 1
+				}
+			}
+			g.Expect(numSchedulable).To(Equal(2))
+		}).Should(Succeed())
+		Consistently(func(g Gomega) {
+			err := k8sClient.List(ctx, pods, &client.ListOptions{Namespace: testName})
+			g.Expect(err).NotTo(HaveOccurred())
+			numSchedulable := 0
+			for _, pod := range pods.Items {
+				if !existsSchedulingGate(&pod) {
+					numSchedulable += 1
+				}
+			}
+			g.Expect(numSchedulable).To(Equal(2))
+		}, "3s").Should(Succeed())
+	})
+
+	It("should share the pulls across the cluster among the tenants by their weights", func() {
+		testName := "fair-share"
+		tenantA := testName + "-a"
+		tenantB := testName + "-b"
+		for _, name := range []string{tenantA, tenantB} {
+			namespace := &corev1.Namespace{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: name,
+				},
+			}
+			if name == tenantB {
+				namespace.Annotations = map[string]string{constants.CatGateWeightAnnotation: "3"}
+			}
+			err := k8sClient.Create(ctx, namespace)
+			Expect(err).NotTo(HaveOccurred())
+
+			minimumCapacity := int32(10)
+			profile := &catgatev1alpha1.CatGateProfile{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace: name,
+					Name:      "wide",
+				},
+				Spec: catgatev1alpha1.CatGateProfileSpec{
+					MinimumCapacity: &minimumCapacity,
+				},
+			}
+			err = k8sClient.Create(ctx, profile)
+			Expect(err).NotTo(HaveOccurred())
+		}
+
+		// the pods released in the other tests are still pulling
+		maxInFlightPulls := int32(countInFlightPulls() + 4)
+		updateConfig(func(spec *catgatev1alpha1.CatGateConfigSpec) {
+			spec.MaxInFlightPulls = maxInFlightPulls
+		})
+		DeferCleanup(func() {
+			updateConfig(func(spec *catgatev1alpha1.CatGateConfigSpec) {
+				spec.MaxInFlightPulls = 0
+			})
+		})
+
+		countReleased := func(g Gomega, namespace string) int {
+			pods := &corev1.PodList{}
+			err := k8sClient.List(ctx, pods, &client.ListOptions{Namespace: namespace})
+			g.Expect(err).NotTo(HaveOccurred())
+			numSchedulable := 0
+			for _, pod := range pods.Items {
+				if !existsSchedulingGate(&pod) {
+					numSchedulable += 1
+				}
+			}
+			return numSchedulable
+		}
+
+		for i := 0; i < 6; i++ {
+			createNewPod(tenantA, i)
+		}
+		Eventually(func(g Gomega) {
+			g.Expect(countReleased(g, tenantA)).To(Equal(4))
+		}).Should(Succeed())
+
+		for i := 0; i < 4; i++ {
+			createNewPod(tenantB, i)
+		}
+		Consistently(func(g Gomega) {
+			g.Expect(countReleased(g, tenantB)).To(Equal(0))
+		}, "2s").Should(Succeed())
+
+		// the pulls of tenant A finish, and the 4 pulls are shared by the weights 1:3.
+		pods := &corev1.PodList{}
+		err := k8sClient.List(ctx, pods, &client.ListOptions{Namespace: tenantA})
+		Expect(err).NotTo(HaveOccurred())
+		for _, pod := range pods.Items {
+			if !existsSchedulingGate(&pod) {
+				updatePodStatus(&pod, corev1.ContainerState{Running: &corev1.ContainerStateRunning{}}, corev1.PodRunning)
+			}
+		}
+
+		Eventually(func(g Gomega) {
+			g.Expect(countReleased(g, tenantA)).To(Equal(5))
+			g.Expect(countReleased(g, tenantB)).To(Equal(3))
+		}).Should(Succeed())
+		Consistently(func(g Gomega) {
+			g.Expect(countReleased(g, tenantA)).To(Equal(5))
+			g.Expect(countReleased(g, tenantB)).To(Equal(3))
+		}, "3s").Should(Succeed())
+	})
+
+	It("should not hold the pods behind the terminating pods", func() {
+		testName := "terminating-gated-pod"
+		namespace := &corev1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: testName,
+			},
+		}
+		err := k8sClient.Create(ctx, namespace)
+		Expect(err).NotTo(HaveOccurred())
+
+		countReleased := func(g Gomega) int {
+			pods := &corev1.PodList{}
+			err := k8sClient.List(ctx, pods, &client.ListOptions{Namespace: testName})
+			g.Expect(err).NotTo(HaveOccurred())
+			numSchedulable := 0
+			for _, pod := range pods.Items {
+				if !existsSchedulingGate(&pod) {
+					numSchedulable += 1
+				}
+			}
+			return numSchedulable
+		}
+
+		// the first pod takes the capacity, so the next pod stays gated.
+		first := createNewPod(testName, 0)
+		Eventually(func(g Gomega) {
+			g.Expect(countReleased(g)).To(Equal(1))
+		}).Should(Succeed())
+
+		// the terminating pod is held by a finalizer and ranked first by its creation.
+		finalizer := "example.com/hold"
+		held := createNewPod(testName, 1, func(pod *corev1.Pod) {
+			pod.Finalizers = []string{finalizer}
+		})
+		DeferCleanup(func() {
+			err := k8sClient.Get(ctx, client.ObjectKeyFromObject(held), held)
+			Expect(err).NotTo(HaveOccurred())
+			held.Finalizers = nil
+			err = k8sClient.Update(ctx, held)
+			Expect(err).NotTo(HaveOccurred())
+		})
+		err = k8sClient.Delete(ctx, held)
+		Expect(err).NotTo(HaveOccurred())
+		createNewPod(testName, 2)
+		Consistently(func(g Gomega) {
+			g.Expect(countReleased(g)).To(Equal(1))
+		}, "2s").Should(Succeed())
+
+		// the first pod finishes pulling, so the pod behind the terminating pod is released.
+		err = k8sClient.Get(ctx, client.ObjectKeyFromObject(first), first)
+		Expect(err).NotTo(HaveOccurred())
+		updatePodStatus(first, corev1.ContainerState{Running: &corev1.ContainerStateRunning{}}, corev1.PodRunning)
+		Eventually(func(g Gomega) {
+			g.Expect(countReleased(g)).To(Equal(2))
+		}).Should(Succeed())
+		err = k8sClient.Get(ctx, client.ObjectKeyFromObject(held), held)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(existsSchedulingGate(held)).To(BeTrue())
+	})
+
+	It("should not hold the pods of a tenant behind the pods of the other tenants with the same images", func() {
+		testName := "shared-images"
+		tenantA := testName + "-a"
+		tenantB := testName + "-b"
+		for _, name := range []string{tenantA, tenantB} {
+			namespace := &corev1.Namespace{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: name,
+				},
+			}
+			err := k8sClient.Create(ctx, namespace)
+			Expect(err).NotTo(HaveOccurred())
+
+			minimumCapacity := int32(10)
+			profile := &catgatev1alpha1.CatGateProfile{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace: name,
+					Name:      "wide",
+				},
+				Spec: catgatev1alpha1.CatGateProfileSpec{
+					MinimumCapacity: &minimumCapacity,
+				},
+			}
+			err = k8sClient.Create(ctx, profile)
+			Expect(err).NotTo(HaveOccurred())
+		}
+
+		// the pods released in the other tests are still pulling
+		maxInFlightPulls := int32(countInFlightPulls() + 4)
+		updateConfig(func(spec *catgatev1alpha1.CatGateConfigSpec) {
+			spec.MaxInFlightPulls = maxInFlightPulls
+		})
+		DeferCleanup(func() {
+			updateConfig(func(spec *catgatev1alpha1.CatGateConfigSpec) {
+				spec.MaxInFlightPulls = 0
+			})
+		})
+
+		countReleased := func(g Gomega, namespace string) int {
+			pods := &corev1.PodList{}
+			err := k8sClient.List(ctx, pods, &client.ListOptions{Namespace: namespace})
+			g.Expect(err).NotTo(HaveOccurred())
+			numSchedulable := 0
+			for _, pod := range pods.Items {
+				if !existsSchedulingGate(&pod) {
+					numSchedulable += 1
+				}
+			}
+			return numSchedulable
+		}
+		// the tenants use the same images, so their pods have the same images hash.
+		sameImages := func(pod *corev1.Pod) {
+			pod.Spec.InitContainers[0].Image = testName + ".example.com/sample1-image:1.0.0"
+			pod.Spec.Containers[0].Image = testName + ".example.com/sample2-image:1.0.0"
+		}
+
+		for i := 0; i < 20; i++ {
+			createNewPod(tenantA, i, sameImages)
+		}
+		Eventually(func(g Gomega) {
+			g.Expect(countReleased(g, tenantA)).To(Equal(4))
+		}).Should(Succeed())
+
+		// the pods of tenant B come after the 16 gated pods of tenant A, which is more than the capacity.
+		for i := 0; i < 2; i++ {
+			createNewPod(tenantB, i, sameImages)
+		}
+		Consistently(func(g Gomega) {
+			g.Expect(countReleased(g, tenantB)).To(Equal(0))
+		}, "2s").Should(Succeed())
+
+		// the pulls of tenant A finish, and the 4 pulls are shared by the tenants equally.
+		pods := &corev1.PodList{}
+		err := k8sClient.List(ctx, pods, &client.ListOptions{Namespace: tenantA})
+		Expect(err).NotTo(HaveOccurred())
+		for _, pod := range pods.Items {
+			if !existsSchedulingGate(&pod) {
+				updatePodStatus(&pod, corev1.ContainerState{Running: &corev1.ContainerStateRunning{}}, corev1.PodRunning)
+			}
+		}
+
+		Eventually(func(g Gomega) {
+			g.Expect(countReleased(g, tenantA)).To(Equal(6))
+			g.Expect(countReleased(g, tenantB)).To(Equal(2))
+		}).Should(Succeed())
+		Consistently(func(g Gomega) {
+			g.Expect(countReleased(g, tenantA)).To(Equal(6))
+			g.Expect(countReleased(g, tenantB)).To(Equal(2))
+		}, "3s").Should(Succeed())
+	})
+
+	It("should limit the number of pulls on each node", func() {
+		testName := "max-pulls-per-node"
+		namespace := &corev1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: testName,
+			},
+		}
+		err := k8sClient.Create(ctx, namespace)
+		Expect(err).NotTo(HaveOccurred())
+
+		updateConfig(func(spec *catgatev1alpha1.CatGateConfigSpec) {
+			spec.MaxPullsPerNode = 1
+		})
+		DeferCleanup(func() {
+			updateConfig(func(spec *catgatev1alpha1.CatGateConfigSpec) {
+				spec.MaxPullsPerNode = 0
+			})
+		})
+
+		minimumCapacity := int32(10)
+		profile := &catgatev1alpha1.CatGateProfile{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: testName,
+				Name:      "wide",
+			},
+			Spec: catgatev1alpha1.CatGateProfileSpec{
+				MinimumCapacity: &minimumCapacity,
+			},
+		}
+		err = k8sClient.Create(ctx, profile)
+		Expect(err).NotTo(HaveOccurred())
+
+		for i := 0; i < 2; i++ {
+			createNewNode(testName, i)
+			node := &corev1.Node{}
+			err = k8sClient.Get(ctx, client.ObjectKey{Name: fmt.Sprintf("%s-node-%d", testName, i)}, node)
+			Expect(err).NotTo(HaveOccurred())
+			node.Labels = map[string]string{testName: "true"}
+			err = k8sClient.Update(ctx, node)
+			Expect(err).NotTo(HaveOccurred())
+		}
+		onlyTestNodes := func(pod *corev1.Pod) {
+			pod.Spec.NodeSelector = map[string]string{testName: "true"}
+		}
+
+		// bind a pulling pod to each of the nodes
+		for i := 0; i < 2; i++ {
+			pod := createNewPod(testName, i, onlyTestNodes)
+			Eventually(func(g Gomega) {
+				err = k8sClient.Get(ctx, client.ObjectKeyFromObject(pod), pod)
+				g.Expect(err).NotTo(HaveOccurred())
+				g.Expect(existsSchedulingGate(pod)).To(BeFalse())
+			}).Should(Succeed())
+			bindPod(pod, fmt.Sprintf("%s-node-%d", testName, i))
+		}
+
+		pod := createNewPod(testName, 2, onlyTestNodes)
+		Consistently(func(g Gomega) {
+			err = k8sClient.Get(ctx, client.ObjectKeyFromObject(pod), pod)
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(existsSchedulingGate(pod)).To(BeTrue())
+		}, "3s").Should(Succeed())
+
+		// a slot is freed when the pod on node-0 starts
+		runningPod := &corev1.Pod{}
+		err = k8sClient.Get(ctx, client.ObjectKey{Name: fmt.Sprintf("%s-pod-%d", testName, 0), Namespace: testName}, runningPod)
+		Expect(err).NotTo(HaveOccurred())
+		runningPod.Status.Phase = corev1.PodRunning
+		err = k8sClient.Status().Update(ctx, runningPod)
+		Expect(err).NotTo(HaveOccurred())
+
+		Eventually(func(g Gomega) {
+			err = k8sClient.Get(ctx, client.ObjectKeyFromObject(pod), pod)
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(existsSchedulingGate(pod)).To(BeFalse())
+		}).Should(Succeed())
+	})
+
+	It("should limit the total size of the images being pulled", func() {
+		testName := "max-bytes-in-flight"
+		namespace := &corev1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: testName,
+			},
+		}
+		err := k8sClient.Create(ctx, namespace)
+		Expect(err).NotTo(HaveOccurred())
+
+		updateConfig(func(spec *catgatev1alpha1.CatGateConfigSpec) {
+			maxBytesInFlight := resource.MustParse("1Gi")
+			spec.MaxBytesInFlight = &maxBytesInFlight
+		})
+		DeferCleanup(func() {
+			updateConfig(func(spec *catgatev1alpha1.CatGateConfigSpec) {
+				spec.MaxBytesInFlight = nil
+			})
+		})
+
+		minimumCapacity := int32(10)
+		profile := &catgatev1alpha1.CatGateProfile{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: testName,
+				Name:      "wide",
+			},
+			Spec: catgatev1alpha1.CatGateProfileSpec{
+				MinimumCapacity: &minimumCapacity,
+			},
+		}
+		err = k8sClient.Create(ctx, profile)
+		Expect(err).NotTo(HaveOccurred())
+
+		// the sizes of the images are learned from the node
+		bigImage := testName + ".example.com/big-image:1.0.0"
+		smallImage := testName + ".example.com/small-image:1.0.0"
+		createNewNode(testName, 0)
+		node := &corev1.Node{}
+		err = k8sClient.Get(ctx, client.ObjectKey{Name: fmt.Sprintf("%s-node-%d", testName, 0)}, node)
+		Expect(err).NotTo(HaveOccurred())
+		node.Status.Images = append(node.Status.Images,
+			corev1.ContainerImage{Names: []string{bigImage}, SizeBytes: 600 << 20},
+			corev1.ContainerImage{Names: []string{smallImage}, SizeBytes: 100 << 20},
+		)
+		err = k8sClient.Status().Update(ctx, node)
+		Expect(err).NotTo(HaveOccurred())
+
+		for i := 0; i < 3; i++ {
+			createNewPod(testName, i, func(pod *corev1.Pod) {
+				pod.Spec.InitContainers = nil
+				pod.Spec.Containers[0].Image = bigImage
+			})
+		}
+		countReleased := func(g Gomega, image string) int {
+			pods := &corev1.PodList{}
+			err := k8sClient.List(ctx, pods, &client.ListOptions{Namespace: testName})
+			g.Expect(err).NotTo(HaveOccurred())
+			numSchedulable := 0
+			for _, pod := range pods.Items {
+				if !existsSchedulingGate(&pod) && pod.Spec.Containers[0].Image == image {
+					numSchedulable += 1
+				}
+			}
+			return numSchedulable
+		}
+		Eventually(func(g Gomega) {
+			g.Expect(countReleased(g, bigImage)).To(Equal(1))
+		}).Should(Succeed())
+		Consistently(func(g Gomega) {
+			// 2 big images exceed the budget
+			g.Expect(countReleased(g, bigImage)).To(Equal(1))
+		}, "3s").Should(Succeed())
+
+		for i := 3; i < 6; i++ {
+			createNewPod(testName, i, func(pod *corev1.Pod) {
+				pod.Spec.InitContainers = nil
+				pod.Spec.Containers[0].Image = smallImage
+			})
+		}
+		Eventually(func(g Gomega) {
+			// 1 big image and 3 small images fit in the budget
+			g.Expect(countReleased(g, smallImage)).To(Equal(3))
+		}).Should(Succeed())
+	})
+
+	It("should remove scheduling gates of the pods gated for too long", func() {
+		testName := "max-gate-hold"
+		namespace := &corev1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: testName,
+			},
+		}
+		err := k8sClient.Create(ctx, namespace)
+		Expect(err).NotTo(HaveOccurred())
+
+		maxGateHoldSeconds := int32(2)
+		profile := &catgatev1alpha1.CatGateProfile{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: testName,
+				Name:      "short-hold",
+			},
+			Spec: catgatev1alpha1.CatGateProfileSpec{
+				MaxGateHoldSeconds: &maxGateHoldSeconds,
+			},
+		}
+		err = k8sClient.Create(ctx, profile)
+		Expect(err).NotTo(HaveOccurred())
+
+		for i := 0; i < 3; i++ {
+			createNewPod(testName, i)
+		}
+
+		pods := &corev1.PodList{}
+		Eventually(func(g Gomega) {
+			err := k8sClient.List(ctx, pods, &client.ListOptions{Namespace: testName})
+			g.Expect(err).NotTo(HaveOccurred())
+			numSchedulable := 0
+			for _, pod := range pods.Items {
+				if !existsSchedulingGate(&pod) {
+					numSchedulable += 1
+				}
+			}
+			// the capacity allows only 1 pod, but the others are released after 2 seconds
+			g.Expect(numSchedulable).To(Equal(3))
+		}).Should(Succeed())
+
+		events := &corev1.EventList{}
+		Eventually(func(g Gomega) {
+			err := k8sClient.List(ctx, events, &client.ListOptions{Namespace: testName})
+			g.Expect(err).NotTo(HaveOccurred())
+			var reasons []string
+			for _, event := range events.Items {
+				reasons = append(reasons, event.Reason)
+			}
+			g.Expect(reasons).To(ContainElement(eventReasonGateHoldTimeout))
+		}).Should(Succeed())
+	})
+
+	It("should raise the capacity while the pods wait longer than the target", func() {
+		testName := "target-wait"
+		namespace := &corev1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: testName,
+			},
+		}
+		err := k8sClient.Create(ctx, namespace)
+		Expect(err).NotTo(HaveOccurred())
+
+		targetWaitSeconds := int32(1)
+		profile := &catgatev1alpha1.CatGateProfile{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: testName,
+				Name:      "slo",
+			},
+			Spec: catgatev1alpha1.CatGateProfileSpec{
+				TargetWaitSeconds: &targetWaitSeconds,
+			},
+		}
+		err = k8sClient.Create(ctx, profile)
+		Expect(err).NotTo(HaveOccurred())
+
+		for i := 0; i < 6; i++ {
+			createNewPod(testName, i)
+		}
+
+		pods := &corev1.PodList{}
+		Eventually(func(g Gomega) {
+			err := k8sClient.List(ctx, pods, &client.ListOptions{Namespace: testName})
+			g.Expect(err).NotTo(HaveOccurred())
+			numSchedulable := 0
+			for _, pod := range pods.Items {
+				if !existsSchedulingGate(&pod) {
+					numSchedulable += 1
+				}
+			}
+			// no pods start, but the capacity is raised by 2 every second
+			g.Expect(numSchedulable).To(Equal(6))
+		}).Should(Succeed())
+	})
+
+	It("should lower the capacity boost while the images hash has no gated pods", func() {
+		boost := &CapacityBoost{}
+		now := time.Now()
+		// the rollout waits longer than the target for 5 intervals
+		for i := 0; i < 5; i++ {
+			now = now.Add(time.Second)
+			Expect(boost.observe(now, time.Minute, time.Second, time.Second)).To(Equal(i + 1))
+		}
+
+		// the next rollout starts 1 hour later, after the boost is lowered for the intervals without gated pods
+		now = now.Add(time.Hour)
+		Expect(boost.observe(now, 0, time.Second, time.Second)).To(Equal(0))
+
+		// the boost is lowered for the missed intervals before it is raised again
+		for i := 0; i < 3; i++ {
+			now = now.Add(time.Second)
+			boost.observe(now, time.Minute, time.Second, time.Second)
+		}
+		now = now.Add(3 * time.Second)
+		Expect(boost.observe(now, time.Minute, time.Second, time.Second)).To(Equal(2))
+	})
+
+	It("should not count the pods bound to the nodes that have the images as pulling", func() {
+		testName := "warm-nodes"
+		namespace := &corev1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: testName,
+			},
+		}
+		err := k8sClient.Create(ctx, namespace)
+		Expect(err).NotTo(HaveOccurred())
+
+		createNewNode(testName, 0)
+		node := &corev1.Node{}
+		err = k8sClient.Get(ctx, client.ObjectKey{Name: fmt.Sprintf("%s-node-%d", testName, 0)}, node)
+		Expect(err).NotTo(HaveOccurred())
+		for i := 0; i < 4; i++ {
+			pod := createNewPod(testName, i)
+			if i == 0 {
+				updateNodeImageStatus(node, pod.Spec.InitContainers)
+				updateNodeImageStatus(node, pod.Spec.Containers)
+			}
+		}
+
+		pods := &corev1.PodList{}
+		Eventually(func(g Gomega) {
+			err := k8sClient.List(ctx, pods, &client.ListOptions{Namespace: testName})
+			g.Expect(err).NotTo(HaveOccurred())
+			numSchedulable := 0
+			for _, pod := range pods.Items {
+				if !existsSchedulingGate(&pod) {
+					numSchedulable += 1
+				}
+			}
+			// 1 node has the images, so 2(1*2) pods should be scheduled
+			g.Expect(numSchedulable).To(Equal(2))
+		}).Should(Succeed())
+
+		// the pods bound to the node that has the images pull nothing.
+		for _, pod := range pods.Items {
+			if !existsSchedulingGate(&pod) {
+				bindPod(&pod, node.Name)
+			}
+		}
+
+		Eventually(func(g Gomega) {
+			err := k8sClient.List(ctx, pods, &client.ListOptions{Namespace: testName})
+			g.Expect(err).NotTo(HaveOccurred())
+			numSchedulable := 0
+			for _, pod := range pods.Items {
+				if !existsSchedulingGate(&pod) {
+					numSchedulable += 1
+				}
+			}
+			g.Expect(numSchedulable).To(Equal(4))
+		}).Should(Succeed())
+	})
+
+	It("should regard the images of the running pods as on their nodes", func() {
+		testName := "running-pod-images"
+		namespace := &corev1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: testName,
+			},
+		}
+		err := k8sClient.Create(ctx, namespace)
+		Expect(err).NotTo(HaveOccurred())
+
+		updateConfig(func(spec *catgatev1alpha1.CatGateConfigSpec) {
+			spec.ImageSightingTTLSeconds = 60
+		})
+		DeferCleanup(func() {
+			updateConfig(func(spec *catgatev1alpha1.CatGateConfigSpec) {
+				spec.ImageSightingTTLSeconds = 0
+			})
+		})
+
+		// the node does not report the images in its status.
+		createNewNode(testName, 0)
+		for i := 0; i < 5; i++ {
+			createNewPod(testName, i)
+		}
+
+		pod := &corev1.Pod{}
+		Eventually(func(g Gomega) {
+			err = k8sClient.Get(ctx, client.ObjectKey{Name: fmt.Sprintf("%s-pod-%d", testName, 0), Namespace: testName}, pod)
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(existsSchedulingGate(pod)).To(BeFalse())
+		}).Should(Succeed())
+		bindPod(pod, fmt.Sprintf("%s-node-%d", testName, 0))
+		err = k8sClient.Get(ctx, client.ObjectKeyFromObject(pod), pod)
+		Expect(err).NotTo(HaveOccurred())
+		pod.Status.Phase = corev1.PodRunning
+		pod.Status.InitContainerStatuses = []corev1.ContainerStatus{
+			{
+				Name:    pod.Spec.InitContainers[0].Name,
+				Image:   pod.Spec.InitContainers[0].Image,
+				ImageID: "sha256:1",
+				State:   corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{}},
+			},
+		}
+		pod.Status.ContainerStatuses = []corev1.ContainerStatus{
+			{
+				Name:    pod.Spec.Containers[0].Name,
+				Image:   pod.Spec.Containers[0].Image,
+				ImageID: "sha256:2",
+				State:   corev1.ContainerState{Running: &corev1.ContainerStateRunning{}},
+			},
+		}
+		err = k8sClient.Status().Update(ctx, pod)
+		Expect(err).NotTo(HaveOccurred())
+
+		pods := &corev1.PodList{}
+		Eventually(func(g Gomega) {
+			err := k8sClient.List(ctx, pods, &client.ListOptions{Namespace: testName})
+			g.Expect(err).NotTo(HaveOccurred())
+			numSchedulable := 0
+			for _, pod := range pods.Items {
+				if !existsSchedulingGate(&pod) {
+					numSchedulable += 1
+				}
+			}
+			// the running pod shows that 1 node has the images, so 3(1 + 1*2) pods should be scheduled
+			g.Expect(numSchedulable).To(Equal(3))
+		}).Should(Succeed())
+	})
+
+	It("should keep the images of the running pods on their nodes while the pods are running", func() {
+		testName := "running-pod-images-refresh"
+		namespace := &corev1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: testName,
+			},
+		}
+		err := k8sClient.Create(ctx, namespace)
+		Expect(err).NotTo(HaveOccurred())
+
+		updateConfig(func(spec *catgatev1alpha1.CatGateConfigSpec) {
+			spec.ImageSightingTTLSeconds = 2
+		})
+		DeferCleanup(func() {
+			updateConfig(func(spec *catgatev1alpha1.CatGateConfigSpec) {
+				spec.ImageSightingTTLSeconds = 0
+			})
+		})
+
+		nodeName := fmt.Sprintf("%s-node-%d", testName, 0)
+		createNewNode(testName, 0)
+		createNewPod(testName, 0)
+
+		pod := &corev1.Pod{}
+		Eventually(func(g Gomega) {
+			err = k8sClient.Get(ctx, client.ObjectKey{Name: fmt.Sprintf("%s-pod-%d", testName, 0), Namespace: testName}, pod)
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(existsSchedulingGate(pod)).To(BeFalse())
+		}).Should(Succeed())
+		bindPod(pod, nodeName)
+		err = k8sClient.Get(ctx, client.ObjectKeyFromObject(pod), pod)
+		Expect(err).NotTo(HaveOccurred())
+		pod.Status.Phase = corev1.PodRunning
+		pod.Status.InitContainerStatuses = []corev1.ContainerStatus{
+			{
+				Name:    pod.Spec.InitContainers[0].Name,
+				Image:   pod.Spec.InitContainers[0].Image,
+				ImageID: "sha256:1",
+				State:   corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{}},
+			},
+		}
+		pod.Status.ContainerStatuses = []corev1.ContainerStatus{
+			{
+				Name:    pod.Spec.Containers[0].Name,
+				Image:   pod.Spec.Containers[0].Image,
+				ImageID: "sha256:2",
+				State:   corev1.ContainerState{Running: &corev1.ContainerStateRunning{}},
+			},
+		}
+		err = k8sClient.Status().Update(ctx, pod)
+		Expect(err).NotTo(HaveOccurred())
+
+		images := podImages(pod)
+		Eventually(func(g Gomega) {
+			g.Expect(loadImageSighting(nodeName).images(time.Now(), 2*time.Second)).To(ConsistOf(images))
+		}).Should(Succeed())
+		// the pod is not updated any more, but its images are seen longer than the TTL.
+		Consistently(func(g Gomega) {
+			g.Expect(loadImageSighting(nodeName).images(time.Now(), 2*time.Second)).To(ConsistOf(images))
+		}, "5s").Should(Succeed())
+	})
+
+	It("should record the images of the running pods when the TTL is turned on", func() {
+		testName := "running-pod-images-ttl-on"
+		namespace := &corev1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: testName,
+			},
+		}
+		err := k8sClient.Create(ctx, namespace)
+		Expect(err).NotTo(HaveOccurred())
+
+		nodeName := fmt.Sprintf("%s-node-%d", testName, 0)
+		createNewNode(testName, 0)
+		createNewPod(testName, 0)
+
+		pod := &corev1.Pod{}
+		Eventually(func(g Gomega) {
+			err = k8sClient.Get(ctx, client.ObjectKey{Name: fmt.Sprintf("%s-pod-%d", testName, 0), Namespace: testName}, pod)
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(existsSchedulingGate(pod)).To(BeFalse())
+		}).Should(Succeed())
+		bindPod(pod, nodeName)
+		err = k8sClient.Get(ctx, client.ObjectKeyFromObject(pod), pod)
+		Expect(err).NotTo(HaveOccurred())
+		pod.Status.Phase = corev1.PodRunning
+		pod.Status.ContainerStatuses = []corev1.ContainerStatus{
+			{
+				Name:    pod.Spec.Containers[0].Name,
+				Image:   pod.Spec.Containers[0].Image,
+				ImageID: "sha256:2",
+				State:   corev1.ContainerState{Running: &corev1.ContainerStateRunning{}},
+			},
+		}
+		err = k8sClient.Status().Update(ctx, pod)
+		Expect(err).NotTo(HaveOccurred())
+
+		// the TTL is off, so the images are not recorded.
+		image := imageref.Normalize(pod.Spec.Containers[0].Image)
+		Consistently(func(g Gomega) {
+			g.Expect(loadImageSighting(nodeName).images(time.Now(), time.Minute)).NotTo(ContainElement(image))
+		}, "2s").Should(Succeed())
+
+		// the pod is not updated any more, but its images are recorded when the TTL is turned on.
+		updateConfig(func(spec *catgatev1alpha1.CatGateConfigSpec) {
+			spec.ImageSightingTTLSeconds = 60
+		})
+		DeferCleanup(func() {
+			updateConfig(func(spec *catgatev1alpha1.CatGateConfigSpec) {
+				spec.ImageSightingTTLSeconds = 0
+			})
+		})
+		Eventually(func(g Gomega) {
+			g.Expect(loadImageSighting(nodeName).images(time.Now(), time.Minute)).To(ContainElement(image))
+		}).Should(Succeed())
+	})
+
+	It("should not move the time of the images seen on the nodes back", func() {
+		sighting := &ImageSighting{seenAt: make(map[string]time.Time)}
+		now := time.Now()
+		sighting.observe(now, "example.com/sample-image:1.0.0")
+		// an old Pulled event is replayed.
+		sighting.observe(now.Add(-time.Hour), "example.com/sample-image:1.0.0")
+		Expect(sighting.images(now, time.Minute)).To(ConsistOf("example.com/sample-image:1.0.0"))
+		Expect(sighting.LastUpdated()).To(Equal(now))
+	})
+
+	It("should regard the images of the Pulled events as on the nodes", func() {
+		testName := "pulled-event-images"
+		namespace := &corev1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: testName,
+			},
+		}
+		err := k8sClient.Create(ctx, namespace)
+		Expect(err).NotTo(HaveOccurred())
+
+		updateConfig(func(spec *catgatev1alpha1.CatGateConfigSpec) {
+			spec.ImageSightingTTLSeconds = 60
+		})
+		DeferCleanup(func() {
+			updateConfig(func(spec *catgatev1alpha1.CatGateConfigSpec) {
+				spec.ImageSightingTTLSeconds = 0
+			})
+		})
+
+		// the node does not report the images in its status.
+		createNewNode(testName, 0)
+		images := []string{
+			testName + ".example.com/sample1-image:1.0.0",
+			testName + ".example.com/sample2-image:1.0.0",
+		}
+		for i, image := range images {
+			event := &corev1.Event{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace: testName,
+					Name:      fmt.Sprintf("%s-event-%d", testName, i),
+				},
+				InvolvedObject: corev1.ObjectReference{
+					Kind:      "Pod",
+					Namespace: testName,
+					Name:      "other",
+				},
+				Reason:        "Pulled",
+				Message:       fmt.Sprintf("Successfully pulled image %q in 1.5s (1.5s including waiting)", image),
+				Source:        corev1.EventSource{Component: "kubelet", Host: fmt.Sprintf("%s-node-%d", testName, 0)},
+				LastTimestamp: metav1.Now(),
+				Type:          corev1.EventTypeNormal,
+			}
+			err := k8sClient.Create(ctx, event)
+			Expect(err).NotTo(HaveOccurred())
+		}
+
+		Eventually(func(g Gomega) {
+			g.Expect(loadImageSighting(fmt.Sprintf("%s-node-%d", testName, 0)).images(time.Now(), time.Minute)).To(ConsistOf(images))
+		}).Should(Succeed())
+		for i := 0; i < 5; i++ {
+			createNewPod(testName, i)
+		}
+
+		pods := &corev1.PodList{}
+		Eventually(func(g Gomega) {
+			err := k8sClient.List(ctx, pods, &client.ListOptions{Namespace: testName})
+			g.Expect(err).NotTo(HaveOccurred())
+			numSchedulable := 0
+			for _, pod := range pods.Items {
+				if !existsSchedulingGate(&pod) {
+					numSchedulable += 1
+				}
+			}
+			// the events show that 1 node has the images, so 2(1*2) pods should be scheduled
+			g.Expect(numSchedulable).To(Equal(2))
+		}).Should(Succeed())
+	})
+
+	It("should add the images of the fresh inventories of the nodes to their statuses", func() {
+		testName := "node-image-inventory"
+		namespace := &corev1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: testName,
+			},
+		}
+		err := k8sClient.Create(ctx, namespace)
+		Expect(err).NotTo(HaveOccurred())
+
+		images := []catgatev1alpha1.NodeImage{
+			{Names: []string{testName + ".example.com/sample1-image:1.0.0"}, SizeBytes: 1000},
+			{Names: []string{testName + ".example.com/sample2-image:1.0.0"}, SizeBytes: 1000},
+		}
+		// node 0 does not report the images in its status, but its inventory has them.
+		// node 1 reports the images in its status, but its inventory does not have them.
+		// node 2 does not report the images in its status, and its inventory that has them is stale.
+		for i := 0; i < 3; i++ {
+			createNewNode(testName, i)
+			inventory := &catgatev1alpha1.NodeImageInventory{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: fmt.Sprintf("%s-node-%d", testName, i),
+				},
+				Spec: catgatev1alpha1.NodeImageInventorySpec{
+					ObservedTime:    metav1.Now(),
+					IntervalSeconds: 60,
+				},
+			}
+			switch i {
+			case 0:
+				inventory.Spec.Images = images
+			case 2:
+				inventory.Spec.Images = images
+				inventory.Spec.ObservedTime = metav1.NewTime(time.Now().Add(-time.Hour))
+			}
+			err := k8sClient.Create(ctx, inventory)
+			Expect(err).NotTo(HaveOccurred())
+		}
+		for i := 0; i < 7; i++ {
+			pod := createNewPod(testName, i)
+			if i == 0 {
+				node := &corev1.Node{}
+				err := k8sClient.Get(ctx, client.ObjectKey{Name: fmt.Sprintf("%s-node-%d", testName, 1)}, node)
+				Expect(err).NotTo(HaveOccurred())
+				updateNodeImageStatus(node, pod.Spec.InitContainers)
+				updateNodeImageStatus(node, pod.Spec.Containers)
+			}
+		}
+
+		pods := &corev1.PodList{}
+		Eventually(func(g Gomega) {
+			err := k8sClient.List(ctx, pods, &client.ListOptions{Namespace: testName})
+			g.Expect(err).NotTo(HaveOccurred())
+			numSchedulable := 0
+			for _, pod := range pods.Items {
+				if !existsSchedulingGate(&pod) {
+					numSchedulable += 1
+				}
+			}
+			// 2 nodes have the images, so 4(2*2) pods should be scheduled
+			g.Expect(numSchedulable).To(Equal(4))
+		}).Should(Succeed())
+
+		Consistently(func(g Gomega) {
+			err := k8sClient.List(ctx, pods, &client.ListOptions{Namespace: testName})
+			g.Expect(err).NotTo(HaveOccurred())
+			numSchedulable := 0
+			for _, pod := range pods.Items {
+				if !existsSchedulingGate(&pod) {
+					numSchedulable += 1
+				}
+			}
+			g.Expect(numSchedulable).To(Equal(4))
+		}, "3s").Should(Succeed())
+	})
+
+	It("should not limit the pods by the images that are never pulled", func() {
+		testName := "never-pull"
+		namespace := &corev1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: testName,
+			},
+		}
+		err := k8sClient.Create(ctx, namespace)
+		Expect(err).NotTo(HaveOccurred())
+
+		// the node has only the container image. the init container image is never pulled.
+		createNewNode(testName, 0)
+		for i := 0; i < 5; i++ {
+			pod := createNewPod(testName, i, func(pod *corev1.Pod) {
+				pod.Spec.InitContainers[0].ImagePullPolicy = corev1.PullNever
+			})
+			if i == 0 {
+				node := &corev1.Node{}
+				err := k8sClient.Get(ctx, client.ObjectKey{Name: fmt.Sprintf("%s-node-%d", testName, 0)}, node)
+				Expect(err).NotTo(HaveOccurred())
+				updateNodeImageStatus(node, pod.Spec.Containers)
+			}
+		}
+
+		pods := &corev1.PodList{}
+		Eventually(func(g Gomega) {
+			err := k8sClient.List(ctx, pods, &client.ListOptions{Namespace: testName})
+			g.Expect(err).NotTo(HaveOccurred())
+			numSchedulable := 0
+			for _, pod := range pods.Items {
+				if !existsSchedulingGate(&pod) {
+					numSchedulable += 1
+				}
+			}
+			// 1 node has the container image, so 2(1*2) pods should be scheduled
+			g.Expect(numSchedulable).To(Equal(2))
+		}).Should(Succeed())
+
+		Consistently(func(g Gomega) {
+			err := k8sClient.List(ctx, pods, &client.ListOptions{Namespace: testName})
+			g.Expect(err).NotTo(HaveOccurred())
+			numSchedulable := 0
+			for _, pod := range pods.Items {
+				if !existsSchedulingGate(&pod) {
+					numSchedulable += 1
+				}
+			}
+			g.Expect(numSchedulable).To(Equal(2))
+		}, "3s").Should(Succeed())
+	})
+
+	It("should not count the nodes that have the images pulled with the Always policy", func() {
+		testName := "always-pull"
+		namespace := &corev1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: testName,
+			},
+		}
+		err := k8sClient.Create(ctx, namespace)
+		Expect(err).NotTo(HaveOccurred())
+
+		for i := 0; i < 2; i++ {
+			createNewNode(testName, i)
+		}
+		for i := 0; i < 5; i++ {
+			pod := createNewPod(testName, i, func(pod *corev1.Pod) {
+				pod.Spec.Containers[0].ImagePullPolicy = corev1.PullAlways
+			})
+			if i == 0 {
+				for j := 0; j < 2; j++ {
+					node := &corev1.Node{}
+					err := k8sClient.Get(ctx, client.ObjectKey{Name: fmt.Sprintf("%s-node-%d", testName, j)}, node)
+					Expect(err).NotTo(HaveOccurred())
+					updateNodeImageStatus(node, pod.Spec.InitContainers)
+					updateNodeImageStatus(node, pod.Spec.Containers)
+				}
+			}
+		}
+
+		pods := &corev1.PodList{}
+		Eventually(func(g Gomega) {
+			err := k8sClient.List(ctx, pods, &client.ListOptions{Namespace: testName})
+			g.Expect(err).NotTo(HaveOccurred())
+			numSchedulable := 0
+			for _, pod := range pods.Items {
+				if !existsSchedulingGate(&pod) {
+					numSchedulable += 1
+				}
+			}
+			// the container image is pulled again on the nodes, so only the minimum capacity 1 is available
+			g.Expect(numSchedulable).To(Equal(1))
+		}).Should(Succeed())
+
+		Consistently(func(g Gomega) {
+			err := k8sClient.List(ctx, pods, &client.ListOptions{Namespace: testName})
+			g.Expect(err).NotTo(HaveOccurred())
+			numSchedulable := 0
+			for _, pod := range pods.Items {
+				if !existsSchedulingGate(&pod) {
+					numSchedulable += 1
+				}
+			}
+			g.Expect(numSchedulable).To(Equal(1))
+		}, "3s").Should(Succeed())
+	})
+
+	It("should count the nodes that have the digest-pinned images pulled with the Always policy", func() {
+		testName := "always-pull-digest"
+		namespace := &corev1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: testName,
+			},
+		}
+		err := k8sClient.Create(ctx, namespace)
+		Expect(err).NotTo(HaveOccurred())
+
+		digest := "sha256:6ed4ac8e6e1c5e4dc2e1fc6a8bca5a1a8b1b3c3e0d1d9b1b1a0e1f1e1d1c1b1a"
+		for i := 0; i < 2; i++ {
+			createNewNode(testName, i)
+		}
+		for i := 0; i < 5; i++ {
+			pod := createNewPod(testName, i, func(pod *corev1.Pod) {
+				pod.Spec.Containers[0].Image = testName + ".example.com/sample2-image@" + digest
+				pod.Spec.Containers[0].ImagePullPolicy = corev1.PullAlways
+			})
+			if i == 0 {
+				node := &corev1.Node{}
+				err := k8sClient.Get(ctx, client.ObjectKey{Name: fmt.Sprintf("%s-node-%d", testName, 0)}, node)
+				Expect(err).NotTo(HaveOccurred())
+				updateNodeImageStatus(node, pod.Spec.InitContainers)
+				updateNodeImageStatus(node, pod.Spec.Containers)
+			}
+		}
+
+		pods := &corev1.PodList{}
+		Eventually(func(g Gomega) {
+			err := k8sClient.List(ctx, pods, &client.ListOptions{Namespace: testName})
+			g.Expect(err).NotTo(HaveOccurred())
+			numSchedulable := 0
+			for _, pod := range pods.Items {
+				if !existsSchedulingGate(&pod) {
+					numSchedulable += 1
+				}
+			}
+			// 1 node has the images, so 2(1*2) pods should be scheduled
+			g.Expect(numSchedulable).To(Equal(2))
+		}).Should(Succeed())
+
+		Consistently(func(g Gomega) {
+			err := k8sClient.List(ctx, pods, &client.ListOptions{Namespace: testName})
+			g.Expect(err).NotTo(HaveOccurred())
+			numSchedulable := 0
+			for _, pod := range pods.Items {
+				if !existsSchedulingGate(&pod) {
+					numSchedulable += 1
+				}
+			}
+			g.Expect(numSchedulable).To(Equal(2))
+		}, "3s").Should(Succeed())
+	})
+
+	It("should release the pods in the order of priority and creation", func() {
+		testName := "release-order"
+		namespace := &corev1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: testName,
+			},
+		}
+		err := k8sClient.Create(ctx, namespace)
+		Expect(err).NotTo(HaveOccurred())
+
+		priorityClass := &schedulingv1.PriorityClass{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: testName + "-high",
+			},
+			Value: 1000,
+		}
+		err = k8sClient.Create(ctx, priorityClass)
+		Expect(err).NotTo(HaveOccurred())
+
+		createNewPod(testName, 0)
+		pod := &corev1.Pod{}
+		Eventually(func(g Gomega) {
+			err := k8sClient.Get(ctx, client.ObjectKey{Namespace: testName, Name: fmt.Sprintf("%s-pod-%d", testName, 0)}, pod)
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(existsSchedulingGate(pod)).To(BeFalse())
+		}).Should(Succeed())
+
+		for i := 1; i < 3; i++ {
+			createNewPod(testName, i)
+		}
+		createNewPod(testName, 3, func(pod *corev1.Pod) {
+			pod.Spec.PriorityClassName = priorityClass.Name
+		})
+
+		// the pod pulling images finishes, so there is room for 1 pod.
+		updatePodStatus(pod, corev1.ContainerState{Running: &corev1.ContainerStateRunning{}}, corev1.PodRunning)
+
+		pods := &corev1.PodList{}
+		Eventually(func(g Gomega) {
+			err := k8sClient.List(ctx, pods, &client.ListOptions{Namespace: testName})
+			g.Expect(err).NotTo(HaveOccurred())
+			var released []string
+			for _, pod := range pods.Items {
+				if !existsSchedulingGate(&pod) {
+					released = append(released, pod.Name)
+				}
+			}
+			g.Expect(released).To(ConsistOf(fmt.Sprintf("%s-pod-%d", testName, 0), fmt.Sprintf("%s-pod-%d", testName, 3)))
+		}).Should(Succeed())
+
+		Consistently(func(g Gomega) {
+			err := k8sClient.List(ctx, pods, &client.ListOptions{Namespace: testName})
+			g.Expect(err).NotTo(HaveOccurred())
+			numSchedulable := 0
+			for _, pod := range pods.Items {
+				if !existsSchedulingGate(&pod) {
+					numSchedulable += 1
+				}
+			}
+			g.Expect(numSchedulable).To(Equal(2))
+		}, "3s").Should(Succeed())
+	})
+
+	It("should remove scheduling gates of the critical pods immediately", func() {
+		testName := "critical-pods"
+		namespace := &corev1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: testName,
+			},
+		}
+		err := k8sClient.Create(ctx, namespace)
+		Expect(err).NotTo(HaveOccurred())
+
+		for i := 0; i < 3; i++ {
+			createNewPod(testName, i)
+		}
+		for i := 3; i < 5; i++ {
+			createNewPod(testName, i, func(pod *corev1.Pod) {
+				pod.Spec.PriorityClassName = "system-cluster-critical"
+			})
+		}
+
+		pods := &corev1.PodList{}
+		Eventually(func(g Gomega) {
+			err := k8sClient.List(ctx, pods, &client.ListOptions{Namespace: testName})
+			g.Expect(err).NotTo(HaveOccurred())
+			numSchedulable := 0
+			for _, pod := range pods.Items {
+				if !existsSchedulingGate(&pod) {
+					numSchedulable += 1
+				}
+			}
+			// 1 pod is released by the capacity, and the critical pods are released regardless of it
+			g.Expect(numSchedulable).To(Equal(3))
+		}).Should(Succeed())
+
+		Consistently(func(g Gomega) {
+			err := k8sClient.List(ctx, pods, &client.ListOptions{Namespace: testName})
+			g.Expect(err).NotTo(HaveOccurred())
+			numSchedulable := 0
+			for _, pod := range pods.Items {
+				if !existsSchedulingGate(&pod) {
+					numSchedulable += 1
+				}
+			}
+			g.Expect(numSchedulable).To(Equal(3))
+		}, "3s").Should(Succeed())
+	})
+
+	It("should not count the pods held by the other scheduling gates as pulling", func() {
+		testName := "other-gates"
+		namespace := &corev1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: testName,
+			},
+		}
+		err := k8sClient.Create(ctx, namespace)
+		Expect(err).NotTo(HaveOccurred())
+
+		for i := 0; i < 3; i++ {
+			createNewPod(testName, i, func(pod *corev1.Pod) {
+				pod.Spec.SchedulingGates = []corev1.PodSchedulingGate{{Name: "example.com/other"}}
+			})
+		}
+
+		pods := &corev1.PodList{}
+		Eventually(func(g Gomega) {
+			err := k8sClient.List(ctx, pods, &client.ListOptions{Namespace: testName})
+			g.Expect(err).NotTo(HaveOccurred())
+			numSchedulable := 0
+			for _, pod := range pods.Items {
+				if !existsSchedulingGate(&pod) {
+					numSchedulable += 1
+				}
+			}
+			// the released pods are still held by the other gate, so they are not pulling
+			g.Expect(numSchedulable).To(Equal(3))
+		}).Should(Succeed())
+	})
+
+	It("should remove the scheduling gate after the other scheduling gates", func() {
+		testName := "remove-after-gates"
+		namespace := &corev1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: testName,
+			},
+		}
+		err := k8sClient.Create(ctx, namespace)
+		Expect(err).NotTo(HaveOccurred())
+
+		otherGate := "example.com/queue"
+		updateConfig(func(spec *catgatev1alpha1.CatGateConfigSpec) {
+			spec.RemoveAfterGates = []string{otherGate}
+		})
+		DeferCleanup(func() {
+			updateConfig(func(spec *catgatev1alpha1.CatGateConfigSpec) {
+				spec.RemoveAfterGates = nil
+			})
+		})
+
+		createNewPod(testName, 0, func(pod *corev1.Pod) {
+			pod.Spec.SchedulingGates = []corev1.PodSchedulingGate{{Name: otherGate}}
+		})
+
+		pod := &corev1.Pod{}
+		Consistently(func(g Gomega) {
+			err = k8sClient.Get(ctx, client.ObjectKey{Name: fmt.Sprintf("%s-pod-%d", testName, 0), Namespace: testName}, pod)
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(existsSchedulingGate(pod)).To(BeTrue())
+		}, "3s").Should(Succeed())
+
+		pod.Spec.SchedulingGates = slices.DeleteFunc(pod.Spec.SchedulingGates, func(gate corev1.PodSchedulingGate) bool {
+			return gate.Name == otherGate
+		})
+		err = k8sClient.Update(ctx, pod)
+		Expect(err).NotTo(HaveOccurred())
+
+		Eventually(func(g Gomega) {
+			err = k8sClient.Get(ctx, client.ObjectKey{Name: fmt.Sprintf("%s-pod-%d", testName, 0), Namespace: testName}, pod)
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(existsSchedulingGate(pod)).To(BeFalse())
+		}).Should(Succeed())
+	})
+
+	It("should not count the time waiting for the other scheduling gates as the hold time", func() {
+		testName := "remove-after-gates-hold"
+		namespace := &corev1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: testName,
+			},
+		}
+		err := k8sClient.Create(ctx, namespace)
+		Expect(err).NotTo(HaveOccurred())
+
+		maxGateHoldSeconds := int32(4)
+		profile := &catgatev1alpha1.CatGateProfile{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: testName,
+				Name:      "short-hold",
+			},
+			Spec: catgatev1alpha1.CatGateProfileSpec{
+				MaxGateHoldSeconds: &maxGateHoldSeconds,
+			},
+		}
+		err = k8sClient.Create(ctx, profile)
+		Expect(err).NotTo(HaveOccurred())
+
+		otherGate := "example.com/queue"
+		updateConfig(func(spec *catgatev1alpha1.CatGateConfigSpec) {
+			spec.RemoveAfterGates = []string{otherGate}
+		})
+		DeferCleanup(func() {
+			updateConfig(func(spec *catgatev1alpha1.CatGateConfigSpec) {
+				spec.RemoveAfterGates = nil
+			})
+		})
+
+		for i := 0; i < 3; i++ {
+			createNewPod(testName, i, func(pod *corev1.Pod) {
+				pod.Spec.SchedulingGates = []corev1.PodSchedulingGate{{Name: otherGate}}
+			})
+		}
+
+		countReleased := func(g Gomega) int {
+			pods := &corev1.PodList{}
+			err := k8sClient.List(ctx, pods, &client.ListOptions{Namespace: testName})
+			g.Expect(err).NotTo(HaveOccurred())
+			numSchedulable := 0
+			for _, pod := range pods.Items {
+				if !existsSchedulingGate(&pod) {
+					numSchedulable += 1
+				}
+			}
+			return numSchedulable
+		}
+		// the pods wait for the other scheduling gate longer than the hold time.
+		Consistently(func(g Gomega) {
+			g.Expect(countReleased(g)).To(Equal(0))
+		}, "5s").Should(Succeed())
+
+		for i := 0; i < 3; i++ {
+			pod := &corev1.Pod{}
+			err = k8sClient.Get(ctx, client.ObjectKey{Name: fmt.Sprintf("%s-pod-%d", testName, i), Namespace: testName}, pod)
+			Expect(err).NotTo(HaveOccurred())
+			pod.Spec.SchedulingGates = slices.DeleteFunc(pod.Spec.SchedulingGates, func(gate corev1.PodSchedulingGate) bool {
+				return gate.Name == otherGate
+			})
+			err = k8sClient.Update(ctx, pod)
+			Expect(err).NotTo(HaveOccurred())
+		}
+
+		// the capacity allows only 1 pod, and the hold time starts when the other scheduling gate is removed.
+		Eventually(func(g Gomega) {
+			g.Expect(countReleased(g)).To(Equal(1))
+		}).Should(Succeed())
+		Consistently(func(g Gomega) {
+			g.Expect(countReleased(g)).To(Equal(1))
+		}, "2s").Should(Succeed())
+		Eventually(func(g Gomega) {
+			g.Expect(countReleased(g)).To(Equal(3))
+		}).Should(Succeed())
+	})
+
+	It("should use the parameters of the profile", func() {
+		testName := "profile-parameters"
+		namespace := &corev1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: testName,
+			},
+		}
+		err := k8sClient.Create(ctx, namespace)
+		Expect(err).NotTo(HaveOccurred())
+
+		scaleRate := int32(4)
+		profile := &catgatev1alpha1.CatGateProfile{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: testName,
+				Name:      "fast",
+			},
+			Spec: catgatev1alpha1.CatGateProfileSpec{
+				ScaleRate: &scaleRate,
+			},
+		}
+		err = k8sClient.Create(ctx, profile)
+		Expect(err).NotTo(HaveOccurred())
+
+		for i := 0; i < 10; i++ {
+			createNewPod(testName, i, func(pod *corev1.Pod) {
+				pod.Annotations = map[string]string{constants.CatGateProfileAnnotation: "fast"}
+			})
+			createNewNode(testName, i)
+		}
+
+		pods := &corev1.PodList{}
+		Eventually(func(g Gomega) {
+			err := k8sClient.List(ctx, pods, &client.ListOptions{Namespace: testName})
+			g.Expect(err).NotTo(HaveOccurred())
+			numSchedulable := 0
+			for _, pod := range pods.Items {
+				if !existsSchedulingGate(&pod) {
+					numSchedulable += 1
+				}
+			}
+			// no nodes with images exist, so 1 pods should be scheduled
+			g.Expect(numSchedulable).To(Equal(1))
+		}).Should(Succeed())
+		scheduleAndStartPods(testName)
+
+		Eventually(func(g Gomega) {
+			err := k8sClient.List(ctx, pods, &client.ListOptions{Namespace: testName})
+			g.Expect(err).NotTo(HaveOccurred())
+			numSchedulable := 0
+			for _, pod := range pods.Items {
+				if !existsSchedulingGate(&pod) {
+					numSchedulable += 1
+				}
+			}
+			// several images exist on 1 node, so 5(1 + 1*4) pods should be scheduled
+			g.Expect(numSchedulable).To(Equal(5))
+		}).Should(Succeed())
+	})
 })
 
-func createNewPod(testName string, index int) *corev1.Pod {
+func createNewPod(testName string, index int, mutators ...func(*corev1.Pod)) *corev1.Pod {
 	newPod := &corev1.Pod{
 		ObjectMeta: metav1.ObjectMeta{
 			Namespace: testName,
@@ -389,6 +2798,9 @@ func createNewPod(testName string, index int) *corev1.Pod {
 			},
 		},
 	}
+	for _, mutate := range mutators {
+		mutate(newPod)
+	}
 	err := k8sClient.Create(ctx, newPod)
 	Expect(err).NotTo(HaveOccurred())
 	return newPod
@@ -399,7 +2811,11 @@ func createNewNode(testName string, index int) {
 		ObjectMeta: metav1.ObjectMeta{
 			Name: fmt.Sprintf("%s-node-%d", testName, index),
 		},
-		Status: corev1.NodeStatus{},
+		Status: corev1.NodeStatus{
+			Conditions: []corev1.NodeCondition{
+				{Type: corev1.NodeReady, Status: corev1.ConditionTrue},
+			},
+		},
 	}
 	err := k8sClient.Create(ctx, newNode)
 	Expect(err).NotTo(HaveOccurred())
@@ -467,7 +2883,7 @@ func scheduleAndStartOneUnhealthyPod(namespace string) {
 
 	for _, pod := range pods.Items {
 		if !existsSchedulingGate(&pod) && len(pod.Status.ContainerStatuses) == 0 {
-			updatePodStatus(&pod, corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "RunContainerError"}}, corev1.PodPending)
+			updatePodStatus(&pod, corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "ContainerCreating"}}, corev1.PodPending)
 			node := &corev1.Node{}
 			err = k8sClient.Get(ctx, client.ObjectKey{Name: pod.Status.HostIP}, node)
 			Expect(err).NotTo(HaveOccurred())
@@ -478,6 +2894,60 @@ func scheduleAndStartOneUnhealthyPod(namespace string) {
 	}
 }
 
+func countInFlightPulls() int {
+	pods := &corev1.PodList{}
+	err := k8sClient.List(ctx, pods)
+	Expect(err).NotTo(HaveOccurred())
+
+	numPulling := 0
+	for _, pod := range pods.Items {
+		if pod.Annotations[constants.CatGateImagesHashAnnotation] == "" || existsSchedulingGate(&pod) || pod.Status.Phase != corev1.PodPending {
+			continue
+		}
+		if !isUnschedulable(&pod) && len(pullingImages(&pod)) > 0 {
+			numPulling += 1
+		}
+	}
+	return numPulling
+}
+
+func bindPod(pod *corev1.Pod, nodeName string) {
+	binding := &corev1.Binding{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: pod.Namespace,
+			Name:      pod.Name,
+		},
+		Target: corev1.ObjectReference{
+			Kind: "Node",
+			Name: nodeName,
+		},
+	}
+	err := k8sClient.SubResource("binding").Create(ctx, pod, binding)
+	Expect(err).NotTo(HaveOccurred())
+}
+
+func markOneUnschedulablePod(namespace string) {
+	pods := &corev1.PodList{}
+	err := k8sClient.List(ctx, pods, client.InNamespace(namespace))
+	Expect(err).NotTo(HaveOccurred())
+
+	for _, pod := range pods.Items {
+		if !existsSchedulingGate(&pod) && len(pod.Status.Conditions) == 0 {
+			pod.Status.Phase = corev1.PodPending
+			pod.Status.Conditions = []corev1.PodCondition{
+				{
+					Type:   corev1.PodScheduled,
+					Status: corev1.ConditionFalse,
+					Reason: corev1.PodReasonUnschedulable,
+				},
+			}
+			err = k8sClient.Status().Update(ctx, &pod)
+			Expect(err).NotTo(HaveOccurred())
+			break
+		}
+	}
+}
+
 func updatePodStatus(pod *corev1.Pod, state corev1.ContainerState, phase corev1.PodPhase) {
 	pod.Status.ContainerStatuses = []corev1.ContainerStatus{
 		{
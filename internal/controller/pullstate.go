@@ -0,0 +1,211 @@
+package controller
+
+import (
+	"regexp"
+	"slices"
+
+	"github.com/cybozu-go/cat-gate/internal/imageref"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// the waiting reasons of containers reported by kubelet.
+const (
+	reasonErrImagePull      = "ErrImagePull"
+	reasonImagePullBackOff  = "ImagePullBackOff"
+	reasonContainerCreating = "ContainerCreating"
+	reasonPodInitializing   = "PodInitializing"
+)
+
+// releasedState is the state of a released pod that is still pending.
+type releasedState int
+
+const (
+	// releasedWaiting is the state in which the pod pulls nothing, e.g. it is held by the scheduling gates
+	// of the other controllers, or its node has all the images.
+	releasedWaiting releasedState = iota
+	// releasedUnschedulable is the state in which the scheduler cannot place the pod.
+	releasedUnschedulable
+	// releasedPulling is the state in which the pod is pulling images.
+	releasedPulling
+)
+
+// classifyReleasedPod returns the state of the released pod that is still pending, with the images of the pod
+// that the state is counted for. imageSets are the images on each node.
+// The pod controller and the status of CatGateQuota share this classification so that they agree on the pulls.
+func classifyReleasedPod(pod *corev1.Pod, imageSets map[string]imageref.Set) (releasedState, []string) {
+	// the pods held by the scheduling gates of the other controllers are not scheduled yet.
+	if len(pod.Spec.SchedulingGates) > 0 {
+		return releasedWaiting, nil
+	}
+	// the pods that the scheduler cannot place do not pull images, so they are counted separately.
+	if isUnschedulable(pod) {
+		return releasedUnschedulable, podImages(pod)
+	}
+	// the pods are counted only for the images that are not on their nodes yet.
+	images := pullingImagesOnNode(pod, imageSets[pod.Spec.NodeName])
+	if len(images) == 0 {
+		return releasedWaiting, nil
+	}
+	return releasedPulling, images
+}
+
+// pullingImages returns the normalized images of the pod that are not on its node yet.
+// They are being pulled or will be pulled as soon as kubelet starts the containers.
+// An image used by several containers is on the node once any of the containers has it.
+func pullingImages(pod *corev1.Pod) []string {
+	statuses := make(map[string]*corev1.ContainerStatus)
+	for i := range pod.Status.InitContainerStatuses {
+		statuses[pod.Status.InitContainerStatuses[i].Name] = &pod.Status.InitContainerStatuses[i]
+	}
+	for i := range pod.Status.ContainerStatuses {
+		statuses[pod.Status.ContainerStatuses[i].Name] = &pod.Status.ContainerStatuses[i]
+	}
+	sandboxReady := readyToStartContainers(pod)
+
+	pulled := imageref.NewSet()
+	var pulling []string
+	classify := func(containers []corev1.Container) {
+		for _, c := range containers {
+			image := imageref.Normalize(c.Image)
+			if image == "" || !pullsImage(c) {
+				continue
+			}
+			status, ok := statuses[c.Name]
+			if ok && !imagePulling(status, sandboxReady) {
+				pulled.Insert(image)
+				continue
+			}
+			if !slices.Contains(pulling, image) {
+				pulling = append(pulling, image)
+			}
+		}
+	}
+	classify(pod.Spec.InitContainers)
+	classify(pod.Spec.Containers)
+
+	var images []string
+	for _, image := range pulling {
+		if !pulled.Has(image) {
+			images = append(images, image)
+		}
+	}
+	return images
+}
+
+// pullingImagesOnNode returns the images of the pod that are not on its node yet,
+// excluding the images that the node reports to have, e.g. before kubelet reports the container statuses.
+// The images pulled with the Always pull policy are not excluded because they are pulled even if the node has them.
+// nodeImageSet is nil if the pod is not bound yet.
+func pullingImagesOnNode(pod *corev1.Pod, nodeImageSet imageref.Set) []string {
+	alwaysPulled := alwaysPulledImages(pod)
+	return slices.DeleteFunc(pullingImages(pod), func(image string) bool {
+		return nodeImageSet.Has(image) && !alwaysPulled.Has(image)
+	})
+}
+
+// pullsImage returns false if kubelet never pulls the image of the container.
+func pullsImage(c corev1.Container) bool {
+	return c.ImagePullPolicy != corev1.PullNever
+}
+
+// alwaysPulledImages returns the images of the pod that are pulled even on the nodes that have them,
+// i.e. the images of the containers with the Always pull policy.
+// The images referenced by digest are excluded because the pull only resolves the digest
+// and downloads nothing if the node has the image.
+func alwaysPulledImages(pod *corev1.Pod) imageref.Set {
+	set := imageref.NewSet()
+	for _, containers := range [][]corev1.Container{pod.Spec.InitContainers, pod.Spec.Containers} {
+		for _, c := range containers {
+			if c.ImagePullPolicy == corev1.PullAlways && imageref.Parse(c.Image).Digest == "" {
+				set.Insert(c.Image)
+			}
+		}
+	}
+	return set
+}
+
+// imagePulling returns true if the image of the container is not on the node yet.
+func imagePulling(status *corev1.ContainerStatus, sandboxReady bool) bool {
+	if status.ImageID != "" {
+		return false
+	}
+	if status.State.Waiting == nil {
+		// running or terminated containers have their images.
+		return false
+	}
+
+	switch status.State.Waiting.Reason {
+	case reasonErrImagePull, reasonImagePullBackOff:
+		return true
+	case reasonContainerCreating, reasonPodInitializing, "":
+		// kubelet pulls images after the sandbox is created.
+		// Until then, the pod is waiting for something else such as volume mounts.
+		return sandboxReady
+	default:
+		// the other reasons such as CreateContainerConfigError and CrashLoopBackOff are reported after the image is pulled.
+		return false
+	}
+}
+
+// readyToStartContainers returns false if the sandbox of the pod has not been created yet.
+// The condition is not reported by old kubelets, so its absence is regarded as ready.
+func readyToStartContainers(pod *corev1.Pod) bool {
+	for _, cond := range pod.Status.Conditions {
+		if cond.Type == corev1.PodReadyToStartContainers {
+			return cond.Status == corev1.ConditionTrue
+		}
+	}
+	return true
+}
+
+// pullFailing returns true if any container of the pod has failed to pull its image.
+func pullFailing(pod *corev1.Pod) bool {
+	for _, statuses := range [][]corev1.ContainerStatus{pod.Status.InitContainerStatuses, pod.Status.ContainerStatuses} {
+		for _, status := range statuses {
+			if status.State.Waiting == nil {
+				continue
+			}
+			switch status.State.Waiting.Reason {
+			case reasonErrImagePull, reasonImagePullBackOff:
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// the messages of the registries that limit the rate of pulls, e.g. "toomanyrequests" of Docker Hub.
+// 429 is matched only as the HTTP status, because the message also includes the image reference, e.g. "app:1.429".
+var rateLimitMessage = regexp.MustCompile(`(?i)toomanyrequests|too many requests|status(?: code)?:? 429\b`)
+
+// rateLimitedRegistries returns the registry hosts that reject the pulls of the pod because of rate limiting.
+func rateLimitedRegistries(pod *corev1.Pod) []string {
+	images := make(map[string]string)
+	for _, c := range pod.Spec.InitContainers {
+		images[c.Name] = c.Image
+	}
+	for _, c := range pod.Spec.Containers {
+		images[c.Name] = c.Image
+	}
+
+	var hosts []string
+	for _, statuses := range [][]corev1.ContainerStatus{pod.Status.InitContainerStatuses, pod.Status.ContainerStatuses} {
+		for _, status := range statuses {
+			if status.State.Waiting == nil || !rateLimitMessage.MatchString(status.State.Waiting.Message) {
+				continue
+			}
+			image := status.Image
+			if image == "" {
+				image = images[status.Name]
+			}
+			if image == "" {
+				continue
+			}
+			host := imageref.Parse(image).Domain
+			if !slices.Contains(hosts, host) {
+				hosts = append(hosts, host)
+			}
+		}
+	}
+	return hosts
+}
@@ -0,0 +1,69 @@
+package controller
+
+import (
+	"sync"
+	"time"
+)
+
+// RegistryBackoffs records the backoff of each registry host.
+var RegistryBackoffs = sync.Map{}
+
+// RegistryBackoff holds the removal of scheduling gates for the images of a registry
+// while the registry rejects pulls because of rate limiting.
+// The window doubles each time the registry still limits the rate after the window.
+type RegistryBackoff struct {
+	mu        sync.Mutex
+	until     time.Time
+	steps     int
+	updatedAt time.Time
+}
+
+// loadRegistryBackoff returns the backoff for the registry host.
+func loadRegistryBackoff(host string) *RegistryBackoff {
+	value, _ := RegistryBackoffs.LoadOrStore(host, &RegistryBackoff{})
+	return value.(*RegistryBackoff)
+}
+
+// LastUpdated returns the last time the backoff was evaluated.
+func (b *RegistryBackoff) LastUpdated() time.Time {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.updatedAt
+}
+
+// observe starts a new window if the registry is limiting the rate and the current window has passed.
+// It returns the length of the new window, or zero if no window has been started.
+func (b *RegistryBackoff) observe(now time.Time, rateLimited bool, base, max time.Duration) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.updatedAt = now
+
+	if now.Before(b.until) {
+		return 0
+	}
+	if !rateLimited {
+		b.steps = 0
+		return 0
+	}
+
+	window := base
+	for i := 0; i < b.steps && window < max; i++ {
+		window *= 2
+	}
+	if window > max {
+		window = max
+	}
+	b.steps += 1
+	b.until = now.Add(window)
+	return window
+}
+
+// remaining returns the time left in the current window.
+func (b *RegistryBackoff) remaining(now time.Time) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if now.Before(b.until) {
+		return b.until.Sub(now)
+	}
+	return 0
+}
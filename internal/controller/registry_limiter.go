@@ -0,0 +1,116 @@
+package controller
+
+import (
+	"sync"
+	"time"
+
+	catgatev1alpha1 "github.com/cybozu-go/cat-gate/api/v1alpha1"
+	"golang.org/x/time/rate"
+)
+
+// RegistryLimiters records the token buckets of each registry host configured in CatGateConfig.
+var RegistryLimiters = sync.Map{}
+
+// RegistryLimiter is the token bucket of a registry host and the buckets of the tenants waiting for it.
+// The tenants share the refill of the registry in proportion to their weights,
+// so that a tenant creating many pods at once does not take all the tokens.
+type RegistryLimiter struct {
+	mu      sync.Mutex
+	bucket  *rate.Limiter
+	tenants map[string]*rate.Limiter
+}
+
+// loadRegistryLimiter returns the token buckets for the registry host.
+// The buckets follow the changes of the configuration while keeping their tokens.
+func loadRegistryLimiter(now time.Time, limit catgatev1alpha1.RegistryLimit) *RegistryLimiter {
+	refill := rate.Limit(float64(limit.RefillPerMinute) / 60)
+	burst := int(limit.MaxConcurrentPulls)
+
+	value, loaded := RegistryLimiters.LoadOrStore(limit.Host, &RegistryLimiter{
+		bucket:  rate.NewLimiter(refill, burst),
+		tenants: make(map[string]*rate.Limiter),
+	})
+	limiter := value.(*RegistryLimiter)
+	if loaded {
+		limiter.mu.Lock()
+		defer limiter.mu.Unlock()
+		resize(now, limiter.bucket, refill, burst)
+	}
+	return limiter
+}
+
+// buckets returns the bucket of the registry and the bucket of the tenant.
+// The bucket of the tenant is sized by its weight among the tenants waiting for the registry,
+// and the buckets of the tenants that are no longer waiting are dropped.
+func (l *RegistryLimiter) buckets(now time.Time, limit catgatev1alpha1.RegistryLimit, tenant string) (*rate.Limiter, *rate.Limiter) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	weights, total := activeWeights(now, limit.Host)
+	if _, ok := weights[tenant]; !ok {
+		weights[tenant] = 1
+		total += 1
+	}
+	for t := range l.tenants {
+		if _, ok := weights[t]; !ok {
+			delete(l.tenants, t)
+		}
+	}
+
+	refill := rate.Limit(float64(limit.RefillPerMinute) / 60 * float64(weights[tenant]) / float64(total))
+	burst := max(int(limit.MaxConcurrentPulls)*weights[tenant]/total, 1)
+	bucket, ok := l.tenants[tenant]
+	if !ok {
+		bucket = rate.NewLimiter(refill, burst)
+		l.tenants[tenant] = bucket
+	}
+	resize(now, bucket, refill, burst)
+	return l.bucket, bucket
+}
+
+// resize changes the refill and the burst of the bucket while keeping its tokens.
+func resize(now time.Time, bucket *rate.Limiter, refill rate.Limit, burst int) {
+	if bucket.Limit() != refill {
+		bucket.SetLimitAt(now, refill)
+	}
+	if bucket.Burst() != burst {
+		bucket.SetBurstAt(now, burst)
+	}
+}
+
+// registryTokenWait returns the time until the buckets of every limited registry host have a token for the tenant.
+// It returns zero if all the buckets have tokens.
+func registryTokenWait(now time.Time, hosts []string, limits []catgatev1alpha1.RegistryLimit, tenant string) time.Duration {
+	var wait time.Duration
+	for _, host := range hosts {
+		for _, limit := range limits {
+			if limit.Host != host {
+				continue
+			}
+			registryBucket, tenantBucket := loadRegistryLimiter(now, limit).buckets(now, limit, tenant)
+			for _, bucket := range []*rate.Limiter{registryBucket, tenantBucket} {
+				if tokens := bucket.TokensAt(now); tokens < 1 {
+					d := time.Duration((1 - tokens) / float64(bucket.Limit()) * float64(time.Second))
+					if d > wait {
+						wait = d
+					}
+				}
+			}
+		}
+	}
+	return wait
+}
+
+// takeRegistryTokens takes a token from the buckets of every limited registry host for the tenant.
+func takeRegistryTokens(now time.Time, hosts []string, limits []catgatev1alpha1.RegistryLimit, tenant string) {
+	for _, host := range hosts {
+		for _, limit := range limits {
+			if limit.Host != host {
+				continue
+			}
+			registryBucket, tenantBucket := loadRegistryLimiter(now, limit).buckets(now, limit, tenant)
+			registryBucket.AllowN(now, 1)
+			tenantBucket.AllowN(now, 1)
+		}
+	}
+}
@@ -0,0 +1,245 @@
+package controller
+
+import (
+	"context"
+	"maps"
+	"time"
+
+	catgatev1alpha1 "github.com/cybozu-go/cat-gate/api/v1alpha1"
+	"github.com/cybozu-go/cat-gate/internal/constants"
+	"github.com/cybozu-go/cat-gate/internal/imageref"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// nodeSnapshot summarizes the nodes for the pod being evaluated.
+type nodeSnapshot struct {
+	// nodes are the nodes on which the pod can be placed and which can pull images.
+	nodes []corev1.Node
+	// imageSets are the images on each node, including the nodes not eligible for the pod.
+	imageSets map[string]imageref.Set
+	// numNodesWithImage is the number of the nodes that have each image of the pod.
+	numNodesWithImage map[string]int
+	// imageSizes are the sizes of the images on each node, including the nodes not eligible for the pod.
+	imageSizes map[string]map[string]int64
+	// maxImageSizes are the sizes of the images reported by any node, computed on demand.
+	maxImageSizes map[string]int64
+	// alwaysPulled are the images of the pod that are pulled even on the nodes that have them.
+	alwaysPulled imageref.Set
+}
+
+// snapshotNodes summarizes the nodes for the pod.
+func (r *PodReconciler) snapshotNodes(ctx context.Context, pod *corev1.Pod, images []string, cfg *catgatev1alpha1.CatGateConfigSpec) (*nodeSnapshot, error) {
+	nodeList := &corev1.NodeList{}
+	err := r.List(ctx, nodeList)
+	if err != nil {
+		return nil, err
+	}
+
+	// the nodes on which the pod cannot be placed or which cannot pull images do not add capacity.
+	nodes, err := eligibleNodes(pod, nodeList.Items, excludedNodeSelector(ctx, cfg))
+	if err != nil {
+		return nil, err
+	}
+
+	imageSets, imageSizes, err := listNodeImages(ctx, r, nodeList.Items, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &nodeSnapshot{
+		nodes:             nodes,
+		imageSets:         imageSets,
+		numNodesWithImage: make(map[string]int),
+		imageSizes:        imageSizes,
+		maxImageSizes:     make(map[string]int64),
+		alwaysPulled:      alwaysPulledImages(pod),
+	}
+	// the nodes that have the images pulled with the Always pull policy download them again, so they do not add capacity.
+	for _, node := range nodes {
+		for _, image := range images {
+			if s.imageSets[node.Name].Has(image) && !s.alwaysPulled.Has(image) {
+				s.numNodesWithImage[image] += 1
+			}
+		}
+	}
+	return s, nil
+}
+
+// listNodeImages returns the images on each node and the sizes of the images on each node.
+// The returned values must not be modified.
+func listNodeImages(ctx context.Context, c client.Reader, nodes []corev1.Node, cfg *catgatev1alpha1.CatGateConfigSpec) (map[string]imageref.Set, map[string]map[string]int64, error) {
+	inventoryList := &catgatev1alpha1.NodeImageInventoryList{}
+	err := c.List(ctx, inventoryList)
+	if err != nil {
+		return nil, nil, err
+	}
+	now := time.Now()
+	inventories := make(map[string]*catgatev1alpha1.NodeImageInventory, len(inventoryList.Items))
+	for i := range inventoryList.Items {
+		if inventoryStale(&inventoryList.Items[i], now) {
+			continue
+		}
+		inventories[inventoryList.Items[i].Name] = &inventoryList.Items[i]
+	}
+
+	imageSets := make(map[string]imageref.Set, len(nodes))
+	imageSizes := make(map[string]map[string]int64, len(nodes))
+	for _, node := range nodes {
+		images, sizes := loadNodeImageCache(node.Name).get(now, &node, inventories[node.Name])
+		imageSets[node.Name] = images
+		imageSizes[node.Name] = sizes
+		// the node status may not list the images, so the images seen on the node recently are added.
+		if cfg.ImageSightingTTLSeconds > 0 {
+			seen := loadImageSighting(node.Name).images(now, time.Duration(cfg.ImageSightingTTLSeconds)*time.Second)
+			if len(seen) > 0 {
+				imageSets[node.Name] = maps.Clone(images)
+				imageSets[node.Name].Insert(seen...)
+			}
+		}
+	}
+	return imageSets, imageSizes, nil
+}
+
+// staleInventoryIntervals is the number of the intervals of the node image agent
+// after which NodeImageInventory is regarded as stale, e.g. because the agent has stopped.
+const staleInventoryIntervals = 3
+
+// nodeImages returns the images on the node.
+// The node status lists a limited number of images, so the images in the inventory published by the node image agent
+// are added. inventory is nil if the node has no fresh inventory.
+func nodeImages(node *corev1.Node, inventory *catgatev1alpha1.NodeImageInventory) []corev1.ContainerImage {
+	if inventory == nil {
+		return node.Status.Images
+	}
+	images := make([]corev1.ContainerImage, 0, len(node.Status.Images)+len(inventory.Spec.Images))
+	images = append(images, node.Status.Images...)
+	for _, image := range inventory.Spec.Images {
+		images = append(images, corev1.ContainerImage{Names: image.Names, SizeBytes: image.SizeBytes})
+	}
+	return images
+}
+
+// inventoryStale returns true if the inventory has not been observed for several intervals of the agent.
+func inventoryStale(inventory *catgatev1alpha1.NodeImageInventory, now time.Time) bool {
+	if inventory.Spec.ObservedTime.IsZero() || inventory.Spec.IntervalSeconds <= 0 {
+		return true
+	}
+	interval := time.Duration(inventory.Spec.IntervalSeconds) * time.Second
+	return now.Sub(inventory.Spec.ObservedTime.Time) > staleInventoryIntervals*interval
+}
+
+// nodeImageSet returns the set of the names of the images.
+func nodeImageSet(images []corev1.ContainerImage) imageref.Set {
+	set := imageref.NewSet()
+	for _, image := range images {
+		set.Insert(image.Names...)
+	}
+	return set
+}
+
+// imageSize returns the size of the image reported by any node.
+func (s *nodeSnapshot) imageSize(image string) int64 {
+	if size, ok := s.maxImageSizes[image]; ok {
+		return size
+	}
+	size := int64(0)
+	for _, sizes := range s.imageSizes {
+		size = max(size, sizes[image])
+	}
+	s.maxImageSizes[image] = size
+	return size
+}
+
+// onAllNodes returns true if all the nodes already have the image, i.e. the image is not pulled.
+func (s *nodeSnapshot) onAllNodes(image string) bool {
+	return len(s.nodes) > 0 && s.numNodesWithImage[image] == len(s.nodes)
+}
+
+// podSnapshot summarizes the pods whose scheduling gate has been removed and which are still pending.
+type podSnapshot struct {
+	pods []corev1.Pod
+
+	// the number of the pods pulling each image regardless of their images hash.
+	numImagePullingPods map[string]int
+	// the number of the pods that the scheduler cannot place for each image.
+	numUnschedulablePods map[string]int
+	// the number of the pods pulling images on each node.
+	numPullingPodsOnNode map[string]int
+	// the number of the pods pulling images for each tenant.
+	numPullingPodsOfTenant map[string]int
+	// the number of the pods pulling images in each namespace.
+	numPullingPodsInNamespace map[string]int
+	// the number of the pods pulling images from each registry host.
+	numPullingPodsOfHost map[string]int
+	// the number of the pods pulling images from each registry host for each tenant.
+	numPullingPodsOfHostTenant map[string]map[string]int
+
+	numPulling       int
+	numUnschedulable int
+	numWaiting       int
+
+	// the total size of the images being pulled. The images of unknown sizes are not counted.
+	bytesInFlight int64
+
+	// the registry hosts that reject pulls because of rate limiting.
+	rateLimitedHosts map[string]bool
+}
+
+// snapshotPods summarizes the released pods that are still pending.
+// The tenants of the pods are identified by tenantLabel, or by their namespaces if it is empty.
+func (r *PodReconciler) snapshotPods(ctx context.Context, nodes *nodeSnapshot, tenantLabel string) (*podSnapshot, error) {
+	pods := &corev1.PodList{}
+	err := r.List(ctx, pods, client.MatchingFields{constants.ReleasedPodPhaseField: string(corev1.PodPending)})
+	if err != nil {
+		return nil, err
+	}
+
+	s := &podSnapshot{
+		pods:                       pods.Items,
+		numImagePullingPods:        make(map[string]int),
+		numUnschedulablePods:       make(map[string]int),
+		numPullingPodsOnNode:       make(map[string]int),
+		numPullingPodsOfTenant:     make(map[string]int),
+		numPullingPodsInNamespace:  make(map[string]int),
+		numPullingPodsOfHost:       make(map[string]int),
+		numPullingPodsOfHostTenant: make(map[string]map[string]int),
+		rateLimitedHosts:           make(map[string]bool),
+	}
+	for _, pod := range pods.Items {
+		for _, host := range rateLimitedRegistries(&pod) {
+			s.rateLimitedHosts[host] = true
+		}
+		state, images := classifyReleasedPod(&pod, nodes.imageSets)
+		switch state {
+		case releasedWaiting:
+			s.numWaiting += 1
+			continue
+		case releasedUnschedulable:
+			s.numUnschedulable += 1
+			for _, image := range images {
+				s.numUnschedulablePods[image] += 1
+			}
+			continue
+		}
+		s.numPulling += 1
+		for _, image := range images {
+			s.numImagePullingPods[image] += 1
+			s.bytesInFlight += nodes.imageSize(image)
+		}
+		if pod.Spec.NodeName != "" {
+			s.numPullingPodsOnNode[pod.Spec.NodeName] += 1
+		}
+		tenant := tenantOf(&pod, tenantLabel)
+		s.numPullingPodsOfTenant[tenant] += 1
+		s.numPullingPodsInNamespace[pod.Namespace] += 1
+		for _, host := range imageHosts(images) {
+			s.numPullingPodsOfHost[host] += 1
+			if s.numPullingPodsOfHostTenant[host] == nil {
+				s.numPullingPodsOfHostTenant[host] = make(map[string]int)
+			}
+			s.numPullingPodsOfHostTenant[host][tenant] += 1
+		}
+	}
+	return s, nil
+}
@@ -25,10 +25,12 @@ import (
 	"testing"
 	"time"
 
+	catgatev1alpha1 "github.com/cybozu-go/cat-gate/api/v1alpha1"
 	"github.com/cybozu-go/cat-gate/hooks"
 	"github.com/cybozu-go/cat-gate/internal/indexing"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	"k8s.io/client-go/rest"
@@ -68,6 +70,8 @@ var _ = BeforeSuite(func() {
 
 	By("bootstrapping test environment")
 	testEnv = &envtest.Environment{
+		CRDDirectoryPaths:     []string{filepath.Join("..", "..", "config", "crd", "bases")},
+		ErrorIfCRDPathMissing: true,
 		WebhookInstallOptions: envtest.WebhookInstallOptions{
 			Paths: []string{filepath.Join("..", "..", "config", "webhook", "manifests.yaml")},
 		},
@@ -82,12 +86,26 @@ var _ = BeforeSuite(func() {
 	err = clientgoscheme.AddToScheme(scheme)
 	Expect(err).NotTo(HaveOccurred())
 
+	err = catgatev1alpha1.AddToScheme(scheme)
+	Expect(err).NotTo(HaveOccurred())
+
 	//+kubebuilder:scaffold:scheme
 
 	k8sClient, err = client.New(cfg, client.Options{Scheme: scheme})
 	Expect(err).NotTo(HaveOccurred())
 	Expect(k8sClient).NotTo(BeNil())
 
+	// shorten the requeue interval to speed up the tests.
+	err = k8sClient.Create(ctx, &catgatev1alpha1.CatGateConfig{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: catgatev1alpha1.CatGateConfigName,
+		},
+		Spec: catgatev1alpha1.CatGateConfigSpec{
+			RequeueSeconds: 1,
+		},
+	})
+	Expect(err).NotTo(HaveOccurred())
+
 	// start webhook server using Manager
 	webhookInstallOptions := &testEnv.WebhookInstallOptions
 	mgr, err := ctrl.NewManager(cfg, ctrl.Options{
@@ -108,10 +126,39 @@ var _ = BeforeSuite(func() {
 	Expect(err).NotTo(HaveOccurred())
 
 	reconciler := PodReconciler{
+		Client:   mgr.GetClient(),
+		Scheme:   scheme,
+		Recorder: mgr.GetEventRecorderFor("cat-gate"),
+	}
+	err = reconciler.SetupWithManager(mgr)
+	Expect(err).NotTo(HaveOccurred())
+
+	configReconciler := CatGateConfigReconciler{
 		Client: mgr.GetClient(),
 		Scheme: scheme,
 	}
-	err = reconciler.SetupWithManager(mgr)
+	err = configReconciler.SetupWithManager(mgr)
+	Expect(err).NotTo(HaveOccurred())
+
+	quotaReconciler := CatGateQuotaReconciler{
+		Client: mgr.GetClient(),
+		Scheme: scheme,
+	}
+	err = quotaReconciler.SetupWithManager(mgr)
+	Expect(err).NotTo(HaveOccurred())
+
+	runningPodReconciler := RunningPodReconciler{
+		Client: mgr.GetClient(),
+		Scheme: scheme,
+	}
+	err = runningPodReconciler.SetupWithManager(mgr)
+	Expect(err).NotTo(HaveOccurred())
+
+	pulledEventReconciler := PulledEventReconciler{
+		Client: mgr.GetClient(),
+		Scheme: scheme,
+	}
+	err = pulledEventReconciler.SetupWithManager(mgr)
 	Expect(err).NotTo(HaveOccurred())
 
 	err = hooks.SetupPodWebhookWithManager(mgr)
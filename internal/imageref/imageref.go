@@ -0,0 +1,105 @@
+package imageref
+
+import "strings"
+
+const (
+	defaultDomain       = "docker.io"
+	legacyDefaultDomain = "index.docker.io"
+	officialRepoPrefix  = "library/"
+	defaultTag          = "latest"
+)
+
+// Reference is a container image reference filled with the default registry, repository and tag.
+type Reference struct {
+	// Domain is the registry host of the image such as "docker.io" or "ghcr.io".
+	Domain string
+	// Path is the repository path in the registry such as "library/ubuntu".
+	Path string
+	// Tag is the tag of the image. It is empty when the reference has a digest only.
+	Tag string
+	// Digest is the digest of the image such as "sha256:...". It is empty when the reference has no digest.
+	Digest string
+}
+
+// Parse parses an image reference in the same manner as the container runtimes.
+// "ubuntu" is parsed as "docker.io/library/ubuntu:latest".
+func Parse(image string) Reference {
+	var ref Reference
+
+	name := image
+	if i := strings.IndexRune(name, '@'); i >= 0 {
+		name, ref.Digest = name[:i], name[i+1:]
+	}
+	if i := strings.LastIndex(name, ":"); i > strings.LastIndex(name, "/") {
+		name, ref.Tag = name[:i], name[i+1:]
+	}
+	if ref.Tag == "" && ref.Digest == "" {
+		ref.Tag = defaultTag
+	}
+
+	i := strings.IndexRune(name, '/')
+	if i == -1 || (!strings.ContainsAny(name[:i], ".:") && name[:i] != "localhost" && strings.ToLower(name[:i]) == name[:i]) {
+		ref.Domain, ref.Path = defaultDomain, name
+	} else {
+		ref.Domain, ref.Path = name[:i], name[i+1:]
+	}
+	if ref.Domain == legacyDefaultDomain {
+		ref.Domain = defaultDomain
+	}
+	if ref.Domain == defaultDomain && !strings.ContainsRune(ref.Path, '/') {
+		ref.Path = officialRepoPrefix + ref.Path
+	}
+	return ref
+}
+
+// Name returns the repository name of the image including the registry host.
+func (r Reference) Name() string {
+	return r.Domain + "/" + r.Path
+}
+
+// String returns the canonical form of the reference.
+// The digest takes precedence over the tag because it identifies the image content.
+func (r Reference) String() string {
+	if r.Digest != "" {
+		return r.Name() + "@" + r.Digest
+	}
+	return r.Name() + ":" + r.Tag
+}
+
+// Normalize returns the canonical form of an image reference.
+// Two references that point to the same image have the same canonical form,
+// e.g. "ubuntu:22.04" and "docker.io/library/ubuntu:22.04".
+func Normalize(image string) string {
+	if image == "" {
+		return ""
+	}
+	return Parse(image).String()
+}
+
+// Set is a set of the images on a node.
+type Set map[string]struct{}
+
+// NewSet returns a Set of the given image names.
+// Nodes report both "repo:tag" and "repo@digest" names for an image,
+// so the set matches a reference by either its tag or its digest.
+func NewSet(names ...string) Set {
+	set := make(Set, len(names))
+	set.Insert(names...)
+	return set
+}
+
+// Insert adds the given image names to the set.
+func (s Set) Insert(names ...string) {
+	for _, name := range names {
+		if name == "" {
+			continue
+		}
+		s[Normalize(name)] = struct{}{}
+	}
+}
+
+// Has returns true if the set contains the image.
+func (s Set) Has(image string) bool {
+	_, ok := s[Normalize(image)]
+	return ok
+}
@@ -0,0 +1,43 @@
+package imageref
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Image reference", func() {
+	DescribeTable("should normalize image references",
+		func(image, expected string) {
+			Expect(Normalize(image)).To(Equal(expected))
+		},
+		Entry("official image", "ubuntu", "docker.io/library/ubuntu:latest"),
+		Entry("official image with tag", "ubuntu:22.04", "docker.io/library/ubuntu:22.04"),
+		Entry("docker hub image", "cybozu/ubuntu:22.04", "docker.io/cybozu/ubuntu:22.04"),
+		Entry("legacy docker hub domain", "index.docker.io/ubuntu:22.04", "docker.io/library/ubuntu:22.04"),
+		Entry("fully qualified image", "docker.io/library/ubuntu:22.04", "docker.io/library/ubuntu:22.04"),
+		Entry("other registry", "ghcr.io/cybozu/ubuntu:22.04", "ghcr.io/cybozu/ubuntu:22.04"),
+		Entry("other registry without tag", "ghcr.io/cybozu/ubuntu", "ghcr.io/cybozu/ubuntu:latest"),
+		Entry("registry with port", "localhost:5000/ubuntu", "localhost:5000/ubuntu:latest"),
+		Entry("localhost registry", "localhost/ubuntu:22.04", "localhost/ubuntu:22.04"),
+		Entry("digest", "ubuntu@sha256:0123456789abcdef", "docker.io/library/ubuntu@sha256:0123456789abcdef"),
+		Entry("tag and digest", "ubuntu:22.04@sha256:0123456789abcdef", "docker.io/library/ubuntu@sha256:0123456789abcdef"),
+		Entry("empty", "", ""),
+	)
+
+	It("should parse the registry host", func() {
+		Expect(Parse("ubuntu:22.04")).To(Equal(Reference{Domain: "docker.io", Path: "library/ubuntu", Tag: "22.04"}))
+		Expect(Parse("ghcr.io/cybozu/ubuntu@sha256:0123456789abcdef")).To(Equal(Reference{Domain: "ghcr.io", Path: "cybozu/ubuntu", Digest: "sha256:0123456789abcdef"}))
+	})
+
+	It("should match images by tag or digest", func() {
+		set := NewSet(
+			"docker.io/library/ubuntu@sha256:0123456789abcdef",
+			"docker.io/library/ubuntu:22.04",
+		)
+		Expect(set.Has("ubuntu:22.04")).To(BeTrue())
+		Expect(set.Has("ubuntu@sha256:0123456789abcdef")).To(BeTrue())
+		Expect(set.Has("ubuntu:22.04@sha256:0123456789abcdef")).To(BeTrue())
+		Expect(set.Has("ubuntu:24.04")).To(BeFalse())
+		Expect(set.Has("ubuntu@sha256:fedcba9876543210")).To(BeFalse())
+	})
+})
@@ -0,0 +1,13 @@
+package imageref
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestImageRef(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "ImageRef Suite")
+}
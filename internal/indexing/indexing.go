@@ -10,11 +10,28 @@ import (
 )
 
 func SetupIndexForPod(ctx context.Context, mgr manager.Manager) error {
-	return mgr.GetFieldIndexer().IndexField(ctx, &corev1.Pod{}, constants.ImageHashAnnotationField, func(rawObj client.Object) []string {
+	err := mgr.GetFieldIndexer().IndexField(ctx, &corev1.Pod{}, constants.ImageHashAnnotationField, func(rawObj client.Object) []string {
 		val := rawObj.GetAnnotations()[constants.CatGateImagesHashAnnotation]
 		if val == "" {
 			return nil
 		}
 		return []string{val}
 	})
+	if err != nil {
+		return err
+	}
+
+	// index the phase of the pods whose scheduling gate has been removed by cat-gate.
+	return mgr.GetFieldIndexer().IndexField(ctx, &corev1.Pod{}, constants.ReleasedPodPhaseField, func(rawObj client.Object) []string {
+		pod := rawObj.(*corev1.Pod)
+		if pod.Annotations[constants.CatGateImagesHashAnnotation] == "" {
+			return nil
+		}
+		for _, gate := range pod.Spec.SchedulingGates {
+			if gate.Name == constants.PodSchedulingGateName {
+				return nil
+			}
+		}
+		return []string{string(pod.Status.Phase)}
+	})
 }
@@ -0,0 +1,54 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+const (
+	metricsNamespace = "cat_gate"
+)
+
+// the states of the pods whose scheduling gate has been removed.
+const (
+	// StatePulling is the state of the pods that are pulling or about to pull their images.
+	StatePulling = "pulling"
+	// StateUnschedulable is the state of the pods that the scheduler cannot place.
+	StateUnschedulable = "unschedulable"
+	// StateWaiting is the state of the pods that are not pulling images, e.g. waiting for volumes.
+	StateWaiting = "waiting"
+)
+
+// ReleasedPods is the number of pods whose scheduling gate has been removed and which are still pending.
+var ReleasedPods = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Namespace: metricsNamespace,
+	Name:      "released_pods",
+	Help:      "The number of pods whose scheduling gate has been removed and which are still pending.",
+}, []string{"state"})
+
+// MaxInFlightPulls is the maximum number of pods pulling images across the cluster.
+// It is zero if no limit is configured.
+var MaxInFlightPulls = prometheus.NewGauge(prometheus.GaugeOpts{
+	Namespace: metricsNamespace,
+	Name:      "max_in_flight_pulls",
+	Help:      "The maximum number of pods pulling images across the cluster.",
+})
+
+// BytesInFlight is the total size of the images being pulled across the cluster.
+// The images whose sizes are not known yet are not counted.
+var BytesInFlight = prometheus.NewGauge(prometheus.GaugeOpts{
+	Namespace: metricsNamespace,
+	Name:      "bytes_in_flight",
+	Help:      "The total size of the images being pulled across the cluster.",
+})
+
+// ForcedReleases is the number of scheduling gates removed because the pods were gated for too long.
+var ForcedReleases = prometheus.NewCounter(prometheus.CounterOpts{
+	Namespace: metricsNamespace,
+	Name:      "forced_releases_total",
+	Help:      "The number of scheduling gates removed because the pods were gated for too long.",
+})
+
+func init() {
+	metrics.Registry.MustRegister(ReleasedPods, MaxInFlightPulls, BytesInFlight, ForcedReleases)
+}
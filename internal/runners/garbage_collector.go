@@ -30,12 +30,61 @@ func (gc GarbageCollector) Start(ctx context.Context) error {
 		case <-ctx.Done():
 			return nil
 		case <-ticker.C:
-			controller.GateRemovalHistories.Range(func(imageHash, value interface{}) bool {
+			controller.GateRemovalHistories.Range(func(image, value interface{}) bool {
 				lastGateRemovalTime := value.(time.Time)
 				// Delete history that has not been updated for a long time to prevent memory leaks.
 				if time.Since(lastGateRemovalTime) > time.Duration(historyDeletionDuration)*time.Second {
-					logger.V(constants.LevelDebug).Info("delete old history", "image hash", imageHash, "lastGateRemovalTime", lastGateRemovalTime)
-					controller.GateRemovalHistories.Delete(imageHash)
+					logger.V(constants.LevelDebug).Info("delete old history", "image", image, "lastGateRemovalTime", lastGateRemovalTime)
+					controller.GateRemovalHistories.Delete(image)
+				}
+				return true
+			})
+			controller.CircuitBreakers.Range(func(hash, value interface{}) bool {
+				lastUpdated := value.(*controller.CircuitBreaker).LastUpdated()
+				// Delete the circuit breakers of the images hashes that no longer have gated pods.
+				if time.Since(lastUpdated) > time.Duration(historyDeletionDuration)*time.Second {
+					logger.V(constants.LevelDebug).Info("delete old circuit breaker", "imagesHash", hash, "lastUpdated", lastUpdated)
+					controller.CircuitBreakers.Delete(hash)
+				}
+				return true
+			})
+			controller.RegistryBackoffs.Range(func(host, value interface{}) bool {
+				lastUpdated := value.(*controller.RegistryBackoff).LastUpdated()
+				if time.Since(lastUpdated) > time.Duration(historyDeletionDuration)*time.Second {
+					logger.V(constants.LevelDebug).Info("delete old registry backoff", "registry", host, "lastUpdated", lastUpdated)
+					controller.RegistryBackoffs.Delete(host)
+				}
+				return true
+			})
+			controller.CapacityBoosts.Range(func(hash, value interface{}) bool {
+				lastUpdated := value.(*controller.CapacityBoost).LastUpdated()
+				if time.Since(lastUpdated) > time.Duration(historyDeletionDuration)*time.Second {
+					logger.V(constants.LevelDebug).Info("delete old capacity boost", "imagesHash", hash, "lastUpdated", lastUpdated)
+					controller.CapacityBoosts.Delete(hash)
+				}
+				return true
+			})
+			controller.TenantDemands.Range(func(tenant, value interface{}) bool {
+				lastUpdated := value.(*controller.TenantDemand).LastUpdated()
+				if time.Since(lastUpdated) > time.Duration(historyDeletionDuration)*time.Second {
+					logger.V(constants.LevelDebug).Info("delete old tenant demand", "tenant", tenant, "lastUpdated", lastUpdated)
+					controller.TenantDemands.Delete(tenant)
+				}
+				return true
+			})
+			controller.NodeImageCaches.Range(func(node, value interface{}) bool {
+				lastUpdated := value.(*controller.NodeImageCache).LastUpdated()
+				if time.Since(lastUpdated) > time.Duration(historyDeletionDuration)*time.Second {
+					logger.V(constants.LevelDebug).Info("delete old node image cache", "node", node, "lastUpdated", lastUpdated)
+					controller.NodeImageCaches.Delete(node)
+				}
+				return true
+			})
+			controller.ImageSightings.Range(func(node, value interface{}) bool {
+				lastUpdated := value.(*controller.ImageSighting).LastUpdated()
+				if time.Since(lastUpdated) > time.Duration(historyDeletionDuration)*time.Second {
+					logger.V(constants.LevelDebug).Info("delete old image sighting", "node", node, "lastUpdated", lastUpdated)
+					controller.ImageSightings.Delete(node)
 				}
 				return true
 			})